@@ -1,34 +1,39 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
 	"github.com/nikhil-thomas/web-crawler/internal/crawlers/concurrent"
 	"github.com/nikhil-thomas/web-crawler/internal/platform/http"
+	"github.com/nikhil-thomas/web-crawler/internal/platform/robots"
 	"github.com/nikhil-thomas/web-crawler/internal/sitemap"
 	"github.com/spf13/viper"
 )
 
 func main() {
 	if len(os.Args) <= 1 {
-		fmt.Printf("usage %s url", filepath.Base(os.Args[0]))
+		fmt.Printf("usage %s url [url...]", filepath.Base(os.Args[0]))
 		os.Exit(1)
 	}
 
 	viper.Set("WORKER_COUNT", 10)
 	viper.Set("PAGE_LIMIT", 1000)
-	viper.Set("CRAWLER_TIMEOUT", "5s")
 	viper.Set("CRAWLER_QUEUE_LENGTH", 500)
 	urls := os.Args[1:]
 
-	fetcher := http.NewFetcher()
-	crwlMng := concurrent.NewCrawlManager(fetcher)
+	client := http.NewClient()
+	robotsChecker := robots.NewChecker(http.DefaultUserAgent, client)
 
-	siteMap := sitemap.NewSiteManager(urls[0], crwlMng)
+	fetcher := http.NewFetcher(http.WithClient(client), http.WithRobots(robotsChecker))
+	crwlMng := concurrent.NewCrawlManager(fetcher, crawlers.WithRobots(robotsChecker))
 
-	siteMap.Crawl()
+	siteMap := sitemap.NewSeededSiteManager(urls, crwlMng)
+
+	siteMap.Crawl(context.Background())
 
 	siteMap.PrintMap()
 }
@@ -1,15 +1,29 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
 	"github.com/nikhil-thomas/web-crawler/internal/crawlers/concurrent"
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers/frontier"
 	"github.com/nikhil-thomas/web-crawler/internal/crawlers/simple"
+	"github.com/nikhil-thomas/web-crawler/internal/linkcheck"
 	"github.com/nikhil-thomas/web-crawler/internal/platform/http"
+	"github.com/nikhil-thomas/web-crawler/internal/platform/robots"
 	"github.com/nikhil-thomas/web-crawler/internal/sitemap"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -17,26 +31,491 @@ import (
 
 func main() {
 
-	url := parseFlags()
+	urls := parseFlags()
 
-	log.Info("root   : ", url)
+	for _, url := range urls {
+		log.Info("root   : ", url)
+	}
+
+	fetcherOpts, err := fetcherOptions()
+	if err != nil {
+		fmt.Printf("fetcher error: %s\n", err)
+		os.Exit(1)
+	}
+	// the robots.txt checker shares the fetcher's client settings
+	client := http.NewClient(fetcherOpts...)
+	fetcherOpts = append(fetcherOpts, http.WithClient(client))
+
+	linkPolicy, err := crawlers.NewLinkPolicy(
+		viper.GetStringSlice("FOLLOW_ELEMENTS"),
+		viper.GetStringSlice("RECORD_ELEMENTS"))
+	if err != nil {
+		fmt.Printf("link policy error: %s\n", err)
+		os.Exit(1)
+	}
+
+	trailingSlash, err := crawlers.ParseTrailingSlash(viper.GetString("TRAILING_SLASH"))
+	if err != nil {
+		fmt.Printf("normalizer error: %s\n", err)
+		os.Exit(1)
+	}
+
+	normalizer := &crawlers.Normalizer{
+		SortQuery:     viper.GetBool("SORT_QUERY"),
+		TrailingSlash: trailingSlash,
+		StripParams:   viper.GetStringSlice("STRIP_PARAMS"),
+	}
+
+	scope, err := crawlScope()
+	if err != nil {
+		fmt.Printf("scope error: %s\n", err)
+		os.Exit(1)
+	}
+
+	storage, err := frontier.ParseStorage(viper.GetString("STORAGE"))
+	if err != nil {
+		fmt.Printf("storage error: %s\n", err)
+		os.Exit(1)
+	}
+	// with disk storage the sitemap is not kept in memory,
+	// pages are only streamed to the xml sitemap and the events while the crawl runs
+	streamed := storage == frontier.DiskStorage && viper.GetString("LOAD_JSON") == ""
+	if streamed {
+		if err := checkStreamed(); err != nil {
+			fmt.Printf("storage error: %s\n", err)
+			os.Exit(1)
+		}
+	}
 
-	fetcher := http.NewFetcher()
+	xmlOpts, err := xmlOptions(normalizer)
+	if err != nil {
+		fmt.Printf("xml sitemap error: %s\n", err)
+		os.Exit(1)
+	}
+
+	graphOpts, err := graphOptions()
+	if err != nil {
+		fmt.Printf("graph error: %s\n", err)
+		os.Exit(1)
+	}
+
+	errorPolicy, err := crawlers.ParseErrorPolicy(viper.GetString("ON_ERROR"))
+	if err != nil {
+		fmt.Printf("policy error: %s\n", err)
+		os.Exit(1)
+	}
+
+	crawlerOpts := []crawlers.Option{
+		crawlers.WithErrorPolicy(errorPolicy),
+		crawlers.WithLinkPolicy(linkPolicy),
+		crawlers.WithNormalizer(normalizer),
+		crawlers.WithScope(scope),
+	}
+
+	if !viper.GetBool("IGNORE_ROBOTS") {
+		robotsChecker := robots.NewChecker(viper.GetString("USER_AGENT"), client)
+		fetcherOpts = append(fetcherOpts, http.WithRobots(robotsChecker))
+		crawlerOpts = append(crawlerOpts, crawlers.WithRobots(robotsChecker))
+	}
+
+	// events are streamed while the crawl runs, a partial crawl leaves the events so far
+	var events *crawlers.EventWriter
+	closeEvents := func() error { return nil }
+	if path := viper.GetString("EVENTS_FILE"); path != "" {
+		events, closeEvents, err = openEvents(path)
+		if err != nil {
+			fmt.Printf("events error: %s\n", err)
+			os.Exit(1)
+		}
+		crawlerOpts = append(crawlerOpts, crawlers.WithEventHandler(events.Handle))
+	}
+
+	var xmlWriter *sitemap.XMLWriter
+	if streamed && viper.GetString("XML_DIR") != "" {
+		xmlWriter = sitemap.NewXMLWriter(viper.GetString("XML_DIR"), xmlOpts)
+		crawlerOpts = append(crawlerOpts, crawlers.WithPageHandler(func(url string, depth int, fetched *crawlers.FetchResult, err error) {
+			// a failed write is returned by Close
+			xmlWriter.Add(sitemap.NewPage(url, depth, fetched, err))
+		}))
+	}
+
+	fetcher := http.NewFetcher(fetcherOpts...)
 
 	var crwlMng sitemap.Crawler
 
-	crwlMng = concurrent.NewCrawlManager(fetcher)
+	crwlMng = concurrent.NewCrawlManager(fetcher, crawlerOpts...)
 
 	if viper.GetBool("DISABLE_CONCURRENCY") {
-		crwlMng = simple.NewCrawlManager(fetcher)
+		crwlMng = simple.NewCrawlManager(fetcher, crawlerOpts...)
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	siteMap := sitemap.NewSeededSiteManager(urls, crwlMng)
+	// a sitemap loaded from json is printed and exported without crawling
+	if path := viper.GetString("LOAD_JSON"); path != "" {
+		siteMap, err = loadJSON(path)
+		if err != nil {
+			fmt.Printf("load error: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	crawlErr := siteMap.Crawl(ctx)
+	if events != nil {
+		err := events.Err()
+		if cerr := closeEvents(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			fmt.Printf("events error: %s\n", err)
+		}
+	}
+
+	exported := false
+	if viper.GetString("XML_DIR") != "" {
+		if xmlWriter != nil {
+			writeXML(xmlWriter.Close(siteMap.Roots()))
+		} else {
+			writeXML(siteMap.WriteXML(viper.GetString("XML_DIR"), xmlOpts))
+		}
+		exported = true
+	}
+	if path := viper.GetString("JSON_FILE"); path != "" {
+		writeOutput(path, siteMap.WriteJSON)
+		exported = true
+	}
+	if path := viper.GetString("HTML_FILE"); path != "" {
+		writeOutput(path, siteMap.WriteHTML)
+		exported = true
+	}
+	if path := viper.GetString("DOT_FILE"); path != "" {
+		writeOutput(path, func(w io.Writer) error {
+			return siteMap.WriteDOT(w, graphOpts)
+		})
+		exported = true
+	}
+	if path := viper.GetString("GRAPHML_FILE"); path != "" {
+		writeOutput(path, func(w io.Writer) error {
+			return siteMap.WriteGraphML(w, graphOpts)
+		})
+		exported = true
+	}
+
+	switch {
+	// the links of an interrupted crawl are not checked
+	case viper.GetBool("CHECK_LINKS") && ctx.Err() != nil:
+		log.Warn("check  : skipped : ", ctx.Err())
+	case viper.GetBool("CHECK_LINKS"):
+		checkLinks(ctx, fetcher, siteMap, crawlerOpts)
+	// the sitemap is not printed between events streamed to the standard output
+	case !exported && !streamed && viper.GetString("EVENTS_FILE") != "-":
+		siteMap.PrintMap()
+	}
+	// the pages crawled so far are exported, but an incomplete crawl is a failure
+	if crawlErr != nil {
+		os.Exit(1)
+	}
+}
+
+// loadJSON reads a sitemap written with -json
+func loadJSON(path string) (*sitemap.SiteMapManager, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return sitemap.ReadJSON(f)
+}
+
+// openEvents opens the file crawl events are streamed to as ndjson, - is the standard output
+// the returned function closes the file
+func openEvents(path string) (*crawlers.EventWriter, func() error, error) {
+	if path == "-" {
+		return crawlers.NewEventWriter(os.Stdout), func() error { return nil }, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return crawlers.NewEventWriter(f), f.Close, nil
+}
+
+// writeOutput writes an export of the sitemap to path, - is the standard output
+func writeOutput(path string, write func(w io.Writer) error) {
+	if path == "-" {
+		if err := write(os.Stdout); err != nil {
+			fmt.Printf("export error: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Printf("export error: %s\n", err)
+		os.Exit(1)
+	}
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Printf("export error: %s\n", err)
+		os.Exit(1)
+	}
+	log.Info("write  : ", path)
+}
+
+// graphOptions returns the options of the DOT and GraphML exports from the configuration
+func graphOptions() (sitemap.GraphOptions, error) {
+	edges, err := sitemap.ParseGraphEdges(viper.GetString("GRAPH_EDGES"))
+	if err != nil {
+		return sitemap.GraphOptions{}, err
+	}
+	color, err := sitemap.ParseGraphColor(viper.GetString("GRAPH_COLOR"))
+	if err != nil {
+		return sitemap.GraphOptions{}, err
+	}
+	return sitemap.GraphOptions{
+		Edges:        edges,
+		Color:        color,
+		ClusterDepth: viper.GetInt("GRAPH_CLUSTER"),
+		MaxDepth:     viper.GetInt("GRAPH_DEPTH"),
+	}, nil
+}
+
+// checkLinks prints the broken links found in the crawled pages
+// links are checked with the scope and robots.txt rules of the crawl
+// the program exits with status 1 when a link is broken or checking was interrupted
+func checkLinks(ctx context.Context, fetcher *http.Fetcher, siteMap *sitemap.SiteMapManager, opts []crawlers.Option) {
+	report, err := linkcheck.NewChecker(fetcher, opts...).Check(ctx, siteMap.Roots(), siteMap.Pages, siteMap.Graph)
+	if err != nil {
+		log.Error("check  : ", err)
+	}
+	report.Fprint(os.Stdout)
+	if err != nil || len(report.Broken()) > 0 {
+		os.Exit(1)
+	}
+}
+
+// writeXML reports the sitemaps.org sitemap files written to XML_DIR
+func writeXML(paths []string, err error) {
+	for _, path := range paths {
+		log.Info("write  : ", path)
+	}
+	if err != nil {
+		fmt.Printf("xml sitemap error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// checkStreamed checks that the outputs of a crawl whose sitemap is not kept in memory
+// are streamed while the crawl runs
+func checkStreamed() error {
+	outputs := []struct{ flag, key string }{
+		{"json", "JSON_FILE"},
+		{"html", "HTML_FILE"},
+		{"dot", "DOT_FILE"},
+		{"graphml", "GRAPHML_FILE"},
+	}
+	for _, output := range outputs {
+		if viper.GetString(output.key) != "" {
+			return fmt.Errorf("-%s needs the sitemap in memory, it is not kept with disk storage", output.flag)
+		}
+	}
+	if viper.GetBool("CHECK_LINKS") {
+		return errors.New("-check needs the sitemap in memory, it is not kept with disk storage")
+	}
+	if viper.GetString("XML_DIR") == "" && viper.GetString("EVENTS_FILE") == "" {
+		return errors.New("the sitemap is not kept with disk storage, write it with -xml or -events")
+	}
+	return nil
+}
+
+// xmlOptions returns the options of the sitemaps.org export from the configuration
+func xmlOptions(normalizer *crawlers.Normalizer) (sitemap.XMLOptions, error) {
+	opts := sitemap.XMLOptions{
+		BaseURL:    viper.GetString("XML_BASE_URL"),
+		Gzip:       viper.GetBool("XML_GZIP"),
+		Normalizer: normalizer,
+	}
+	for _, rule := range viper.GetStringSlice("XML_CHANGEFREQ") {
+		xr, err := sitemap.ParseChangeFreqRule(rule)
+		if err != nil {
+			return opts, err
+		}
+		opts.ChangeFreq = append(opts.ChangeFreq, xr)
+	}
+	for _, rule := range viper.GetStringSlice("XML_PRIORITY") {
+		xr, err := sitemap.ParsePriorityRule(rule)
+		if err != nil {
+			return opts, err
+		}
+		opts.Priority = append(opts.Priority, xr)
+	}
+	return opts, nil
+}
+
+// interruptContext returns a context cancelled on SIGINT or SIGTERM
+// so that the pages crawled so far are still printed
+// a second signal terminates the program right away
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Warn("crawl  : ", sig, " : stopping, interrupt again to quit")
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	return ctx, cancel
+}
+
+// crawlScope returns the crawl scope from the configuration
+func crawlScope() (*crawlers.Scope, error) {
+	mode, err := crawlers.ParseScopeMode(viper.GetString("SCOPE"))
+	if err != nil {
+		return nil, err
+	}
+	include, err := crawlers.ParsePathPatterns(viper.GetStringSlice("INCLUDE_PATHS"))
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := crawlers.ParsePathPatterns(viper.GetStringSlice("EXCLUDE_PATHS"))
+	if err != nil {
+		return nil, err
+	}
+	return &crawlers.Scope{
+		Mode:         mode,
+		AllowHosts:   viper.GetStringSlice("ALLOW_HOSTS"),
+		DenyHosts:    viper.GetStringSlice("DENY_HOSTS"),
+		IncludePaths: include,
+		ExcludePaths: exclude,
+	}, nil
+}
+
+// fetcherOptions returns http fetcher options from the configuration
+func fetcherOptions() ([]http.Option, error) {
+	opts := []http.Option{
+		http.WithTimeout(viper.GetDuration("REQUEST_TIMEOUT")),
+		http.WithReadTimeout(viper.GetDuration("READ_TIMEOUT")),
+		http.WithUserAgent(viper.GetString("USER_AGENT")),
+		http.WithMaxBodySize(viper.GetInt64("MAX_BODY_SIZE")),
+	}
+
+	policy, err := retryPolicy()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, http.WithRetry(policy))
+
+	for _, header := range viper.GetStringSlice("HEADERS") {
+		kv := strings.SplitN(header, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("header : %q : expected 'Key: Value'", header)
+		}
+		opts = append(opts, http.WithHeader(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])))
+	}
+
+	if caCert := viper.GetString("CA_CERT"); caCert != "" {
+		pool, err := http.LoadCertPool(caCert)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, http.WithRootCAs(pool))
+	}
+
+	if certFile := viper.GetString("CLIENT_CERT"); certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, viper.GetString("CLIENT_KEY"))
+		if err != nil {
+			return nil, fmt.Errorf("client cert : %s", err)
+		}
+		opts = append(opts, http.WithClientCertificate(cert))
+	}
+
+	if viper.GetBool("INSECURE_SKIP_VERIFY") {
+		log.Warn("tls    : certificate verification disabled")
+		opts = append(opts, http.WithInsecureSkipVerify())
 	}
+	return opts, nil
+}
 
-	siteMap := sitemap.NewSiteManager(url, crwlMng)
-	siteMap.Crawl()
-	siteMap.PrintMap()
+// retryPolicy returns the retry policy of the http fetcher from the configuration
+func retryPolicy() (http.RetryPolicy, error) {
+	var statuses []int
+	for _, status := range viper.GetStringSlice("RETRY_STATUSES") {
+		code, err := strconv.Atoi(status)
+		if err != nil {
+			return http.RetryPolicy{}, fmt.Errorf("retry : status code %q : %s", status, err)
+		}
+		statuses = append(statuses, code)
+	}
+	errs, err := http.ParseTransportErrors(viper.GetStringSlice("RETRY_ERRORS"))
+	if err != nil {
+		return http.RetryPolicy{}, err
+	}
+	return http.RetryPolicy{
+		MaxAttempts:   viper.GetInt("RETRY_ATTEMPTS"),
+		BaseDelay:     viper.GetDuration("RETRY_DELAY"),
+		MaxDelay:      viper.GetDuration("RETRY_MAX_DELAY"),
+		Statuses:      statuses,
+		Errors:        errs,
+		MaxRetryAfter: viper.GetDuration("RETRY_AFTER_MAX"),
+	}, nil
 }
 
-func parseFlags() string {
+// readSeeds reads root urls from a file, one url per line
+// blank lines and lines starting with # are ignored
+func readSeeds(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("seeds : %s", err)
+	}
+	defer f.Close()
+
+	var seeds []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		seeds = append(seeds, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("seeds : %s : %s", path, err)
+	}
+	return seeds, nil
+}
+
+// splitList splits a comma separated flag value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// repeatedFlag collects the values of a flag which can be repeated
+type repeatedFlag []string
+
+func (rf *repeatedFlag) String() string {
+	return strings.Join(*rf, ", ")
+}
+
+func (rf *repeatedFlag) Set(value string) error {
+	*rf = append(*rf, value)
+	return nil
+}
+
+func parseFlags() []string {
 	disableConcurrency := flag.Bool(
 		"con-off",
 		false,
@@ -52,10 +531,20 @@ func parseFlags() string {
 		100,
 		"maximum number of links to be extracted per page to be crawled (set 0 for no limit)")
 
+	maxDepth := flag.Int(
+		"d",
+		0,
+		"maximum number of clicks from root url to be crawled (set 0 for no limit)")
+
+	maxURLs := flag.Int(
+		"max-urls",
+		0,
+		"maximum number of urls found by the crawl, new urls are not added once it is reached (set 0 for no limit)")
+
 	crawlerTimeout := flag.String(
 		"t",
-		"5s",
-		"timeout to stop concurrent crawler when no new links are available [eg: 1s,1ns,1ms,1µs]")
+		"0s",
+		"idle timeout to stop concurrent crawler when no page is completed, set 0 to disable [eg: 1s,1ns,1ms,1µs]")
 
 	logLevel := flag.Int(
 		"log",
@@ -72,34 +561,387 @@ func parseFlags() string {
 		10,
 		"number of workers(goroutines) in concurrent crawling")
 
+	hostDelay := flag.Duration(
+		"host-delay",
+		0,
+		"minimum time between requests to a host (robots.txt Crawl-delay is used when longer)")
+
+	hostRate := flag.Float64(
+		"host-rate",
+		0,
+		"maximum requests per second to a host (set 0 for no limit)")
+
+	hostConcurrency := flag.Int(
+		"host-conns",
+		2,
+		"maximum concurrent requests to a host (set 0 for no limit)")
+
+	globalRate := flag.Float64(
+		"rate",
+		0,
+		"maximum requests per second to all hosts (set 0 for no limit)")
+
+	globalConcurrency := flag.Int(
+		"conns",
+		0,
+		"maximum concurrent requests to all hosts (set 0 to only limit by workers)")
+
 	trimRoot := flag.Bool(
 		"trim",
 		false,
 		"trim root domain name from sitemap")
+
+	onError := flag.String(
+		"on-error",
+		"continue",
+		"what to do when pages fail [continue, abort, abort-after:N]")
+
+	check := flag.Bool(
+		"check",
+		false,
+		"check every link found and print broken links instead of sitemap (exit status 1 when links are broken, skipped when the crawl is interrupted)")
+
+	jsonFile := flag.String(
+		"json",
+		"",
+		"file to write sitemap, page metadata and links to as json instead of printing sitemap (- for stdout)")
+
+	loadFile := flag.String(
+		"load",
+		"",
+		"json file written with -json to print or export instead of crawling")
+
+	eventsFile := flag.String(
+		"events",
+		"",
+		"file to stream crawl events to as ndjson while the crawl runs (- for stdout)")
+
+	htmlFile := flag.String(
+		"html",
+		"",
+		"file to write a self-contained html report to instead of printing sitemap (- for stdout)")
+
+	dotFile := flag.String(
+		"dot",
+		"",
+		"file to write site graph to in Graphviz DOT instead of printing sitemap (- for stdout)")
+
+	graphMLFile := flag.String(
+		"graphml",
+		"",
+		"file to write site graph to in GraphML instead of printing sitemap (- for stdout)")
+
+	graphEdges := flag.String(
+		"graph-edges",
+		"tree",
+		"edges of the DOT and GraphML site graph [tree: sitemap tree, all: every link found]")
+
+	graphColor := flag.String(
+		"graph-color",
+		"none",
+		"color of the DOT and GraphML site graph nodes [none, status, depth]")
+
+	graphCluster := flag.Int(
+		"graph-cluster",
+		0,
+		"cluster the DOT and GraphML site graph nodes by host and this many path segments (set 0 for no clusters)")
+
+	graphDepth := flag.Int(
+		"graph-depth",
+		0,
+		"maximum clicks from root url of the DOT and GraphML site graph nodes (set 0 for no limit)")
+
+	xmlDir := flag.String(
+		"xml",
+		"",
+		"directory to write sitemaps.org sitemap.xml files to instead of printing sitemap")
+
+	xmlBaseURL := flag.String(
+		"xml-base",
+		"",
+		"url the sitemap.xml files are published under, used by the sitemap index (default root url host)")
+
+	xmlGzip := flag.Bool(
+		"xml-gzip",
+		false,
+		"gzip sitemap.xml files")
+
+	var changeFreqs repeatedFlag
+	flag.Var(
+		&changeFreqs,
+		"changefreq",
+		"changefreq of urls whose path matches a pattern, eg: /blog/*=daily (can be repeated, first match wins)")
+
+	var priorities repeatedFlag
+	flag.Var(
+		&priorities,
+		"priority",
+		"priority of urls whose path matches a pattern, eg: /=1.0 (can be repeated, first match wins)")
+
+	ignoreRobots := flag.Bool(
+		"no-robots",
+		false,
+		"do not check robots.txt before crawling a page")
+
+	requestTimeout := flag.Duration(
+		"timeout",
+		http.DefaultTimeout,
+		"time allowed to connect and receive response headers (set 0 for no timeout)")
+
+	readTimeout := flag.Duration(
+		"read-timeout",
+		http.DefaultReadTimeout,
+		"time allowed for a whole request including reading the body (set 0 for no timeout)")
+
+	maxBodySize := flag.Int64(
+		"max-body",
+		http.DefaultMaxBodySize,
+		"largest response body in bytes read from a page (set 0 for no limit)")
+
+	defaultRetry := http.DefaultRetryPolicy()
+
+	attempts := flag.Int(
+		"attempts",
+		defaultRetry.MaxAttempts,
+		"maximum number of requests for a url (set 1 for no retries)")
+
+	retryDelay := flag.Duration(
+		"retry-delay",
+		defaultRetry.BaseDelay,
+		"wait before the first retry, doubled for every retry and jittered")
+
+	retryMaxDelay := flag.Duration(
+		"retry-max-delay",
+		defaultRetry.MaxDelay,
+		"maximum wait between retries")
+
+	retryStatuses := flag.String(
+		"retry-status",
+		"429,502,503,504",
+		"comma separated response status codes to retry")
+
+	retryErrors := flag.String(
+		"retry-errors",
+		"timeout,refused,reset,eof,dns",
+		"comma separated transport errors to retry [timeout, refused, reset, eof, dns]")
+
+	retryAfterMax := flag.Duration(
+		"retry-after-max",
+		defaultRetry.MaxRetryAfter,
+		"longest Retry-After to wait for, responses asking for longer are not retried")
+
+	userAgent := flag.String(
+		"ua",
+		http.DefaultUserAgent,
+		"user agent sent with requests and matched against robots.txt")
+
+	var headers repeatedFlag
+	flag.Var(
+		&headers,
+		"H",
+		"extra request header 'Key: Value' (can be repeated)")
+
+	caCert := flag.String(
+		"ca-cert",
+		"",
+		"PEM file with extra certificate authorities to trust")
+
+	clientCert := flag.String(
+		"cert",
+		"",
+		"PEM file with client certificate")
+
+	clientKey := flag.String(
+		"key",
+		"",
+		"PEM file with client certificate key")
+
+	insecure := flag.Bool(
+		"insecure",
+		false,
+		"skip verification of server certificates (staging only)")
+
+	followElements := flag.String(
+		"follow",
+		strings.Join(crawlers.FollowedElements, ","),
+		"comma separated html elements whose links are crawled")
+
+	recordElements := flag.String(
+		"record",
+		strings.Join(crawlers.RecordedElements, ","),
+		"comma separated html elements whose links are added to sitemap without crawling")
+
+	sortQuery := flag.Bool(
+		"sort-query",
+		false,
+		"sort query parameters before comparing urls")
+
+	trailingSlash := flag.String(
+		"slash",
+		"keep",
+		"trailing slash of url paths [keep, add, remove]")
+
+	stripParams := flag.String(
+		"strip-params",
+		strings.Join(crawlers.DefaultTrackingParams, ","),
+		"comma separated query parameters removed from urls (a trailing * matches a prefix)")
+
+	scope := flag.String(
+		"scope",
+		"host",
+		"hosts to crawl [host: root host with or without www., domain: root domain and its subdomains]")
+
+	allowHosts := flag.String(
+		"allow-hosts",
+		"",
+		"comma separated extra hosts to crawl (*.example.com matches subdomains)")
+
+	denyHosts := flag.String(
+		"deny-hosts",
+		"",
+		"comma separated hosts never to crawl (*.example.com matches subdomains)")
+
+	var includePaths repeatedFlag
+	flag.Var(
+		&includePaths,
+		"include",
+		"only crawl paths matching glob (eg: /docs/*) or regex (eg: re:^/docs/) (can be repeated)")
+
+	var excludePaths repeatedFlag
+	flag.Var(
+		&excludePaths,
+		"exclude",
+		"do not crawl paths matching glob or regex (can be repeated)")
+
+	storage := flag.String(
+		"storage",
+		"memory",
+		"where the frontier and seen urls are kept [memory, disk] (disk keeps no sitemap in memory, pages are only written to -xml and -events)")
+
+	storageDir := flag.String(
+		"storage-dir",
+		"",
+		"directory for disk storage files (default system temporary directory)")
+
+	storageMemoryLimit := flag.Int(
+		"storage-memory",
+		frontier.DefaultMemoryLimit,
+		"number of urls disk storage keeps in memory")
+
+	checkpointFile := flag.String(
+		"checkpoint",
+		"",
+		"state file to save crawl progress to (default the -resume state file)")
+
+	checkpointInterval := flag.Duration(
+		"checkpoint-every",
+		time.Minute,
+		"time between checkpoints of crawl progress")
+
+	resume := flag.String(
+		"resume",
+		"",
+		"state file of an interrupted crawl to continue, root urls are taken from it and cannot be given")
+
+	seedsFile := flag.String(
+		"seeds",
+		"",
+		"file with root urls to crawl, one per line (used with root urls given as arguments)")
 	flag.Parse()
 
 	viper.Set("DISABLE_CONCURRENCY", *disableConcurrency)
 	viper.Set("PAGE_LIMIT", *pageLimit)
 	viper.Set("LINKS_PER_PAGE", *linksPerPage)
+	viper.Set("MAX_DEPTH", *maxDepth)
+	viper.Set("MAX_URLS", *maxURLs)
 	viper.Set("CRAWLER_TIMEOUT", *crawlerTimeout)
 	viper.Set("WORKER_COUNT", *numWorkers)
+	viper.Set("HOST_DELAY", *hostDelay)
+	viper.Set("HOST_RATE", *hostRate)
+	viper.Set("HOST_CONCURRENCY", *hostConcurrency)
+	viper.Set("GLOBAL_RATE", *globalRate)
+	viper.Set("GLOBAL_CONCURRENCY", *globalConcurrency)
 	viper.Set("CRAWLER_QUEUE_LENGTH", *queueLength)
 	viper.Set("TRIM_ROOT", *trimRoot)
+	viper.Set("ON_ERROR", *onError)
+	viper.Set("CHECK_LINKS", *check)
+	viper.Set("JSON_FILE", *jsonFile)
+	viper.Set("LOAD_JSON", *loadFile)
+	viper.Set("EVENTS_FILE", *eventsFile)
+	viper.Set("HTML_FILE", *htmlFile)
+	viper.Set("DOT_FILE", *dotFile)
+	viper.Set("GRAPHML_FILE", *graphMLFile)
+	viper.Set("GRAPH_EDGES", *graphEdges)
+	viper.Set("GRAPH_COLOR", *graphColor)
+	viper.Set("GRAPH_CLUSTER", *graphCluster)
+	viper.Set("GRAPH_DEPTH", *graphDepth)
+	viper.Set("XML_DIR", *xmlDir)
+	viper.Set("XML_BASE_URL", *xmlBaseURL)
+	viper.Set("XML_GZIP", *xmlGzip)
+	viper.Set("XML_CHANGEFREQ", []string(changeFreqs))
+	viper.Set("XML_PRIORITY", []string(priorities))
+	viper.Set("IGNORE_ROBOTS", *ignoreRobots)
+	viper.Set("REQUEST_TIMEOUT", *requestTimeout)
+	viper.Set("READ_TIMEOUT", *readTimeout)
+	viper.Set("MAX_BODY_SIZE", *maxBodySize)
+	viper.Set("RETRY_ATTEMPTS", *attempts)
+	viper.Set("RETRY_DELAY", *retryDelay)
+	viper.Set("RETRY_MAX_DELAY", *retryMaxDelay)
+	viper.Set("RETRY_STATUSES", splitList(*retryStatuses))
+	viper.Set("RETRY_ERRORS", splitList(*retryErrors))
+	viper.Set("RETRY_AFTER_MAX", *retryAfterMax)
+	viper.Set("USER_AGENT", *userAgent)
+	viper.Set("HEADERS", []string(headers))
+	viper.Set("CA_CERT", *caCert)
+	viper.Set("CLIENT_CERT", *clientCert)
+	viper.Set("CLIENT_KEY", *clientKey)
+	viper.Set("INSECURE_SKIP_VERIFY", *insecure)
+	viper.Set("FOLLOW_ELEMENTS", splitList(*followElements))
+	viper.Set("RECORD_ELEMENTS", splitList(*recordElements))
+	viper.Set("SORT_QUERY", *sortQuery)
+	viper.Set("TRAILING_SLASH", *trailingSlash)
+	viper.Set("STRIP_PARAMS", splitList(*stripParams))
+	viper.Set("SCOPE", *scope)
+	viper.Set("ALLOW_HOSTS", splitList(*allowHosts))
+	viper.Set("DENY_HOSTS", splitList(*denyHosts))
+	viper.Set("INCLUDE_PATHS", []string(includePaths))
+	viper.Set("EXCLUDE_PATHS", []string(excludePaths))
+	viper.Set("STORAGE", *storage)
+	viper.Set("STORAGE_DIR", *storageDir)
+	viper.Set("STORAGE_MEMORY_LIMIT", *storageMemoryLimit)
+	viper.Set("CHECKPOINT", *checkpointFile)
+	viper.Set("CHECKPOINT_INTERVAL", *checkpointInterval)
+	viper.Set("RESUME", *resume)
 
 	log.SetLevel(log.Level(*logLevel))
 
 	args := flag.Args()
-	if len(args) < 1 {
-		fmt.Printf("\nusage %s <options> url\n", filepath.Base(os.Args[0]))
+	if *seedsFile != "" {
+		seeds, err := readSeeds(*seedsFile)
+		if err != nil {
+			fmt.Printf("%s\n", err)
+			os.Exit(1)
+		}
+		args = append(args, seeds...)
+	}
+	if len(args) > 0 && *resume != "" {
+		fmt.Printf("resume error: root urls are taken from %s, they cannot be given\n", *resume)
+		os.Exit(1)
+	}
+	if len(args) < 1 && *resume == "" && *loadFile == "" {
+		fmt.Printf("\nusage %s <options> url [url...]\n", filepath.Base(os.Args[0]))
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
-	url, err := url.Parse(args[0])
-
-	if err != nil {
-		fmt.Printf("url parse error: %s\n", err)
-		os.Exit(1)
+	var urls []string
+	for _, arg := range args {
+		url, err := url.Parse(arg)
+		if err != nil {
+			fmt.Printf("url parse error: %s\n", err)
+			os.Exit(1)
+		}
+		urls = append(urls, url.String())
 	}
-	return url.String()
+	return urls
 }
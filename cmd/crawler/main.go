@@ -1,29 +1,35 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
 	"github.com/nikhil-thomas/web-crawler/internal/crawlers/simple"
 	"github.com/nikhil-thomas/web-crawler/internal/platform/http"
+	"github.com/nikhil-thomas/web-crawler/internal/platform/robots"
 	"github.com/nikhil-thomas/web-crawler/internal/sitemap"
 )
 
 func main() {
 	if len(os.Args) <= 1 {
-		fmt.Printf("usage %s url", filepath.Base(os.Args[0]))
+		fmt.Printf("usage %s url [url...]", filepath.Base(os.Args[0]))
 		os.Exit(1)
 	}
 
 	urls := os.Args[1:]
 
-	fetcher := http.NewFetcher()
-	crwlMng := simple.NewCrawlManager(fetcher)
+	client := http.NewClient()
+	robotsChecker := robots.NewChecker(http.DefaultUserAgent, client)
 
-	siteMap := sitemap.NewSiteManager(urls[0], crwlMng)
+	fetcher := http.NewFetcher(http.WithClient(client), http.WithRobots(robotsChecker))
+	crwlMng := simple.NewCrawlManager(fetcher, crawlers.WithRobots(robotsChecker))
 
-	siteMap.Crawl()
+	siteMap := sitemap.NewSeededSiteManager(urls, crwlMng)
+
+	siteMap.Crawl(context.Background())
 
 	siteMap.PrintMap()
 }
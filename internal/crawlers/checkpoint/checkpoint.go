@@ -0,0 +1,589 @@
+package checkpoint
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers/frontier"
+	"github.com/nikhil-thomas/web-crawler/internal/sitemap"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// ErrResumeSeeds is returned when root urls are given to a resumed crawl
+var ErrResumeSeeds = errors.New("root urls are taken from the state file of a resumed crawl")
+
+// Progress defines the state of a crawl
+// urls in the sitemap which are neither crawled nor recorded are still to be crawled
+// the pages processed since the last checkpoint are kept in a journal
+// which is appended to the state file
+type Progress struct {
+	Result *sitemap.Result
+	// Depths holds the number of clicks from the nearest root url of every url found
+	Depths map[string]int
+	// Recorded holds the links kept in sitemap without crawling
+	Recorded map[string]bool
+	// Pages is the number of pages added, Failures the number of them whose fetch failed
+	Pages    int
+	Failures int
+	// Processed is the number of pages processed, urls disallowed by robots.txt are not counted
+	Processed int
+	// stream is set with disk storage, Result, Depths and Recorded are left empty
+	// and only the counts of the crawl are kept in memory
+	stream bool
+	// journal holds the entries not saved yet, last the entry of the last page added
+	journal []*entry
+	last    *entry
+	// source is the state file the progress was loaded from, size its length without
+	// a last line cut short by an interrupted checkpoint
+	source string
+	size   int64
+}
+
+// entry is a line of the state file
+// the first line holds the root urls, every other line a page processed by the crawl
+type entry struct {
+	Roots []string `json:",omitempty"`
+	Page  *page    `json:",omitempty"`
+	// Children are the urls found for the first time in Page
+	Children []child `json:",omitempty"`
+	// Queued are recorded urls queued once they were found in a followable element of Page
+	Queued []string `json:",omitempty"`
+	// Closer are urls found through Page at a shorter depth than before
+	Closer []string `json:",omitempty"`
+}
+
+// page is the saved form of a sitemap.Page
+// Links holds the links of the page kept in the link graph
+type page struct {
+	crawlers.FetchResult
+	Depth   int
+	Err     string `json:",omitempty"`
+	Outcome crawlers.Outcome
+}
+
+// child is a url found for the first time, it is queued when Follow is set and recorded otherwise
+type child struct {
+	URL    string
+	Follow bool `json:",omitempty"`
+}
+
+// NewProgress creates and returns the progress of a crawl starting from rootURLs
+func NewProgress(rootURLs []string) *Progress {
+	result := sitemap.NewResult()
+	result.Roots = rootURLs
+	// root urls are in sitemap from the start so that they are never
+	// recorded as children of another page
+	for _, root := range rootURLs {
+		result.Sitemap[root] = sitemap.Children{}
+	}
+	return &Progress{
+		Result:   result,
+		Depths:   map[string]int{},
+		Recorded: map[string]bool{},
+		journal:  []*entry{{Roots: rootURLs}},
+	}
+}
+
+// Start returns the progress of a crawl starting from rootURLs and adds the urls of the crawl to store,
+// the urls seen to Visited, the urls queued to Queued and the urls still to be crawled to Frontier
+// when RESUME is set, the progress saved in that state file is continued instead,
+// the pages it holds are passed to onPage and ErrResumeSeeds is returned if root urls are given
+// with disk storage the sitemap of the crawl is not kept in memory
+func Start(rootURLs []string, store *frontier.Store, onPage crawlers.PageHandler) (*Progress, error) {
+	path := viper.GetString("RESUME")
+	if path != "" && len(rootURLs) > 0 {
+		return nil, fmt.Errorf("checkpoint : %w", ErrResumeSeeds)
+	}
+	var progress *Progress
+	var err error
+	switch {
+	case store.Storage == frontier.DiskStorage:
+		progress, err = startStream(path, rootURLs, store, onPage)
+	case path == "":
+		progress = NewProgress(rootURLs)
+		err = progress.seed(store)
+	default:
+		progress, err = Load(path)
+		if err == nil {
+			progress.replay(onPage)
+			err = progress.seed(store)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		log.Info("resume : ", path, " : ", progress.Processed, " pages processed : ", store.Frontier.Len(), " pending")
+	}
+	return progress, nil
+}
+
+// seed adds the urls of the sitemap to store, pending urls are pushed at their depth
+func (p *Progress) seed(store *frontier.Store) error {
+	for url := range p.Result.Sitemap {
+		if err := store.Visited.Add(url); err != nil {
+			return err
+		}
+		if p.Recorded[url] {
+			continue
+		}
+		if err := store.Queued.Add(url); err != nil {
+			return err
+		}
+	}
+	var pending []frontier.Entry
+	for _, url := range p.Pending() {
+		pending = append(pending, frontier.Entry{URL: url, Depth: p.Depths[url]})
+	}
+	return store.Frontier.Push(pending...)
+}
+
+// replay passes the pages of progress to onPage in the order of their urls
+// urls disallowed by robots.txt are not pages of the crawl
+func (p *Progress) replay(onPage crawlers.PageHandler) {
+	if onPage == nil {
+		return
+	}
+	var urls []string
+	for url := range p.Result.Pages {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		page := p.Result.Pages[url]
+		if page.Outcome != crawlers.OutcomeRobots {
+			onPage(url, page.Depth, &page.FetchResult, page.Err)
+		}
+	}
+}
+
+// startStream returns the progress of a crawl whose sitemap is not kept in memory
+// the state file of a resumed crawl is read twice, first to add the urls seen and queued
+// to store and pass its pages to onPage, then to push the urls queued but not crawled
+// the pages crawled are kept in a set of store in between
+func startStream(path string, rootURLs []string, store *frontier.Store, onPage crawlers.PageHandler) (*Progress, error) {
+	if path == "" {
+		p := NewProgress(rootURLs)
+		p.stream = true
+		var roots []frontier.Entry
+		for _, root := range rootURLs {
+			if err := store.Visited.Add(root); err != nil {
+				return nil, err
+			}
+			if err := store.Queued.Add(root); err != nil {
+				return nil, err
+			}
+			roots = append(roots, frontier.Entry{URL: root})
+		}
+		return p, store.Frontier.Push(roots...)
+	}
+
+	crawled, err := store.NewSet("crawled")
+	if err != nil {
+		return nil, err
+	}
+	var p *Progress
+	size, err := readJournal(path, func(e *entry) error {
+		if p == nil {
+			p = NewProgress(e.Roots)
+			p.stream = true
+			p.journal = nil
+			return addAll(e.Roots, store.Visited, store.Queued)
+		}
+		if e.Page == nil {
+			return nil
+		}
+		pageErr := e.Page.restoreErr()
+		p.apply(e, pageErr)
+		if onPage != nil && e.Page.Outcome != crawlers.OutcomeRobots {
+			onPage(e.Page.URL, e.Page.Depth, &e.Page.FetchResult, pageErr)
+		}
+		if err := crawled.Add(e.Page.URL); err != nil {
+			return err
+		}
+		for _, c := range e.Children {
+			if err := store.Visited.Add(c.URL); err != nil {
+				return err
+			}
+			if c.Follow {
+				if err := store.Queued.Add(c.URL); err != nil {
+					return err
+				}
+			}
+		}
+		return addAll(e.Queued, store.Queued)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	roots := true
+	_, err = readJournal(path, func(e *entry) error {
+		var urls []string
+		depth := 0
+		if roots {
+			urls, roots = e.Roots, false
+		} else if e.Page != nil {
+			for _, c := range e.Children {
+				if c.Follow {
+					urls = append(urls, c.URL)
+				}
+			}
+			urls = append(urls, e.Queued...)
+			depth = e.Page.Depth + 1
+		}
+		for _, url := range urls {
+			done, err := crawled.Contains(url)
+			if err != nil {
+				return err
+			}
+			if done {
+				continue
+			}
+			if err := store.Frontier.Push(frontier.Entry{URL: url, Depth: depth}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.source, p.size = path, size
+	return p, nil
+}
+
+// addAll adds urls to every one of sets
+func addAll(urls []string, sets ...frontier.VisitedSet) error {
+	for _, url := range urls {
+		for _, set := range sets {
+			if err := set.Add(url); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AddPage adds a page processed at depth with the links of the page kept in the link graph
+// the links found in the page are added with AddChild, Queue and Closer
+// before progress is saved
+func (p *Progress) AddPage(url string, depth int, fetched *crawlers.FetchResult, err error, links []crawlers.Link) {
+	saved := &page{Depth: depth, Outcome: crawlers.Classify(fetched, err)}
+	if fetched != nil {
+		saved.FetchResult = *fetched
+	}
+	saved.URL = url
+	saved.Links = links
+	if err != nil {
+		saved.Err = err.Error()
+	}
+	p.last = &entry{Page: saved}
+	p.journal = append(p.journal, p.last)
+	p.apply(p.last, err)
+}
+
+// AddChild adds a url found for the first time in the last page added
+// the url is queued when follow is set and recorded otherwise
+func (p *Progress) AddChild(url string, follow bool) {
+	c := child{URL: url, Follow: follow}
+	p.last.Children = append(p.last.Children, c)
+	p.addChild(p.last.Page, c)
+}
+
+// Queue marks a recorded url as queued, it was found in a followable element of the last page added
+func (p *Progress) Queue(url string) {
+	p.last.Queued = append(p.last.Queued, url)
+	if !p.stream {
+		delete(p.Recorded, url)
+	}
+}
+
+// Closer sets the depth of url to one click from the last page added
+func (p *Progress) Closer(url string) {
+	p.last.Closer = append(p.last.Closer, url)
+	if !p.stream {
+		p.Depths[url] = p.last.Page.Depth + 1
+	}
+}
+
+// apply adds an entry of the state file to the progress
+// err is the error of the page, restored from the saved message when loading
+func (p *Progress) apply(e *entry, err error) {
+	pg := e.Page
+	p.Pages++
+	if pg.Outcome.Failed() {
+		p.Failures++
+	}
+	if pg.Outcome != crawlers.OutcomeRobots {
+		p.Processed++
+	}
+	if p.stream {
+		return
+	}
+	p.Result.AddPage(pg.URL, pg.Depth, &pg.FetchResult, err)
+	p.Result.Pages[pg.URL].Outcome = pg.Outcome
+	p.Result.Graph.AddLinks(pg.URL, pg.Links)
+	for _, c := range e.Children {
+		p.addChild(pg, c)
+	}
+	for _, url := range e.Queued {
+		delete(p.Recorded, url)
+	}
+	for _, url := range e.Closer {
+		p.Depths[url] = pg.Depth + 1
+	}
+}
+
+func (p *Progress) addChild(parent *page, c child) {
+	if p.stream {
+		return
+	}
+	stmp := p.Result.Sitemap
+	stmp[parent.URL] = append(stmp[parent.URL], c.URL)
+	stmp[c.URL] = sitemap.Children{}
+	p.Depths[c.URL] = parent.Depth + 1
+	if c.Follow {
+		delete(p.Recorded, c.URL)
+	} else {
+		p.Recorded[c.URL] = true
+	}
+}
+
+// Pending returns the urls still to be crawled
+// root urls come first, the others are ordered by depth
+func (p *Progress) Pending() []string {
+	isRoot := map[string]bool{}
+	var pending []string
+	for _, root := range p.Result.Roots {
+		isRoot[root] = true
+		if p.pending(root) {
+			pending = append(pending, root)
+		}
+	}
+	var others []string
+	for url := range p.Result.Sitemap {
+		if !isRoot[url] && p.pending(url) {
+			others = append(others, url)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool {
+		if p.Depths[others[i]] != p.Depths[others[j]] {
+			return p.Depths[others[i]] < p.Depths[others[j]]
+		}
+		return others[i] < others[j]
+	})
+	return append(pending, others...)
+}
+
+func (p *Progress) pending(url string) bool {
+	_, crawled := p.Result.Pages[url]
+	return !crawled && !p.Recorded[url]
+}
+
+// Load reads the progress saved in the state file at path
+// a last line cut short by an interrupted checkpoint is ignored
+func Load(path string) (*Progress, error) {
+	var p *Progress
+	size, err := readJournal(path, func(e *entry) error {
+		switch {
+		case p == nil:
+			p = NewProgress(e.Roots)
+			p.journal = nil
+		case e.Page != nil:
+			p.apply(e, e.Page.restoreErr())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.source, p.size = path, size
+	return p, nil
+}
+
+// readJournal passes every entry of the state file at path to fn and returns
+// the length of the file without a last line cut short by an interrupted checkpoint
+func readJournal(path string, fn func(e *entry) error) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("checkpoint : %s", err)
+	}
+	defer f.Close()
+
+	var size int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				log.Warn("checkpoint : ", path, " : incomplete last line ignored")
+			}
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("checkpoint : %s : %s", path, err)
+		}
+		var e entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return 0, fmt.Errorf("checkpoint : %s : %s", path, err)
+		}
+		if err := fn(&e); err != nil {
+			return 0, err
+		}
+		size += int64(len(line))
+	}
+	if size == 0 {
+		return 0, fmt.Errorf("checkpoint : %s : no crawl saved", path)
+	}
+	return size, nil
+}
+
+// restoreErr returns the error of a saved page, nil when its fetch did not fail
+func (pg *page) restoreErr() error {
+	if pg.Err == "" {
+		return nil
+	}
+	return crawlers.RestoreError(pg.URL, pg.Outcome, pg.StatusCode, pg.Err)
+}
+
+// Checkpointer saves the progress of a crawl at regular intervals
+// every save appends the pages processed since the previous one to the state file
+// a Checkpointer without a path does nothing
+type Checkpointer struct {
+	path     string
+	interval time.Duration
+	last     time.Time
+	// size is the length of the state file once the last save completed, -1 before the first save
+	size int64
+}
+
+// NewCheckpointer creates and returns a Checkpointer
+// which saves progress to path at most once per interval
+func NewCheckpointer(path string, interval time.Duration) *Checkpointer {
+	return &Checkpointer{path: path, interval: interval, last: time.Now(), size: -1}
+}
+
+// NewConfiguredCheckpointer creates and returns a Checkpointer from the
+// CHECKPOINT and CHECKPOINT_INTERVAL configuration
+// progress is saved to the RESUME state file when CHECKPOINT is not set
+func NewConfiguredCheckpointer() *Checkpointer {
+	path := viper.GetString("CHECKPOINT")
+	if path == "" {
+		path = viper.GetString("RESUME")
+	}
+	return NewCheckpointer(path, viper.GetDuration("CHECKPOINT_INTERVAL"))
+}
+
+// Tick saves progress when the interval has passed since the last save
+func (c *Checkpointer) Tick(p *Progress) {
+	if c.path != "" && time.Since(c.last) < c.interval {
+		return
+	}
+	c.Save(p)
+}
+
+// Save saves progress, failures are logged as the crawl can go on without checkpoints
+// the pages of a failed save are saved by the next one
+// without a path the journal of progress is dropped
+func (c *Checkpointer) Save(p *Progress) {
+	if c.path == "" {
+		p.journal = nil
+		return
+	}
+	c.last = time.Now()
+	if err := c.Write(p); err != nil {
+		log.Error("checkpoint : ", err)
+		return
+	}
+	log.Info("checkpoint : ", c.path, " : ", p.Processed, " pages processed")
+}
+
+// Write appends the journal of progress to the state file
+// the first write starts the state file, a resumed crawl continues its own state file
+// or a copy of it
+func (c *Checkpointer) Write(p *Progress) error {
+	if c.size < 0 {
+		if err := c.start(p); err != nil {
+			return fmt.Errorf("checkpoint : %s", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range p.journal {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("checkpoint : %s", err)
+		}
+	}
+
+	f, err := os.OpenFile(c.path, os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("checkpoint : %s", err)
+	}
+	// the tail of a failed save is dropped
+	if err := f.Truncate(c.size); err != nil {
+		f.Close()
+		return fmt.Errorf("checkpoint : %s", err)
+	}
+	n, err := f.WriteAt(buf.Bytes(), c.size)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("checkpoint : %s", err)
+	}
+	c.size += int64(n)
+	p.journal = nil
+	return nil
+}
+
+// start creates the state file, a resumed crawl starts from the state file it was loaded from
+// the previous state file is replaced only once the new one is complete
+func (c *Checkpointer) start(p *Progress) error {
+	if p.source == c.path {
+		c.size = p.size
+		return nil
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if p.source != "" {
+		err = copyFile(tmp, p.source, p.size)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return err
+	}
+	c.size = p.size
+	return nil
+}
+
+// copyFile copies the first size bytes of the file at path to w
+func copyFile(w io.Writer, path string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.CopyN(w, f, size)
+	return err
+}
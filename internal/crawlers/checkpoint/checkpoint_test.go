@@ -0,0 +1,269 @@
+package checkpoint_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers/checkpoint"
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers/frontier"
+	"github.com/spf13/viper"
+)
+
+func TestProgress(t *testing.T) {
+	// a crawl which has processed the root url and two of its links
+	newProgress := func() *checkpoint.Progress {
+		progress := checkpoint.NewProgress([]string{"https://example.com"})
+		progress.AddPage("https://example.com", 0, &crawlers.FetchResult{StatusCode: 200}, nil, []crawlers.Link{
+			{URL: "https://example.com/contact.html", Element: "a", Text: "contact"},
+		})
+		progress.AddChild("https://example.com/contact.html", true)
+		progress.AddChild("https://example.com/about.html", true)
+		progress.AddChild("https://example.com/logo.png", false)
+		progress.AddChild("https://example.com/docs.html", true)
+		progress.AddPage("https://example.com/contact.html", 1, &crawlers.FetchResult{StatusCode: 200}, crawlers.ErrPageNotHTML, nil)
+		progress.AddPage("https://example.com/docs.html", 1, nil, &crawlers.FetchError{
+			URL:  "https://example.com/docs.html",
+			Kind: crawlers.ErrTimeout,
+			Err:  errors.New("i/o timeout"),
+		}, nil)
+		return progress
+	}
+
+	t.Run("it should start with the root urls pending", func(t *testing.T) {
+		progress := checkpoint.NewProgress([]string{"https://example.com", "https://docs.example.org"})
+
+		expected := []string{"https://example.com", "https://docs.example.org"}
+		if got := progress.Pending(); !reflect.DeepEqual(expected, got) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("it should not list crawled and recorded urls as pending", func(t *testing.T) {
+		expected := []string{"https://example.com/about.html"}
+		if got := newProgress().Pending(); !reflect.DeepEqual(expected, got) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+
+	// expectLoaded checks that loaded holds the progress of saved
+	expectLoaded := func(t *testing.T, saved, loaded *checkpoint.Progress) {
+		expectedBytes, _ := json.Marshal(saved.Result.Sitemap)
+		gotBytes, _ := json.Marshal(loaded.Result.Sitemap)
+		if string(expectedBytes) != string(gotBytes) {
+			t.Errorf("expected %s, got %s", expectedBytes, gotBytes)
+		}
+		if !reflect.DeepEqual(saved.Result.Graph.Edges, loaded.Result.Graph.Edges) {
+			t.Errorf("expected links %v, got %v", saved.Result.Graph.Edges, loaded.Result.Graph.Edges)
+		}
+		if !reflect.DeepEqual(saved.Result.Roots, loaded.Result.Roots) {
+			t.Errorf("expected roots %v, got %v", saved.Result.Roots, loaded.Result.Roots)
+		}
+		if !reflect.DeepEqual(saved.Depths, loaded.Depths) ||
+			!reflect.DeepEqual(saved.Recorded, loaded.Recorded) ||
+			saved.Processed != loaded.Processed {
+			t.Errorf("expected %+v, got %+v", saved, loaded)
+		}
+		if !reflect.DeepEqual(saved.Pending(), loaded.Pending()) {
+			t.Errorf("expected pending %v, got %v", saved.Pending(), loaded.Pending())
+		}
+	}
+
+	tempDir := func(t *testing.T) string {
+		dir, err := ioutil.TempDir("", "checkpoint-test-")
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		return dir
+	}
+
+	t.Run("it should save and load progress", func(t *testing.T) {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "crawl.state")
+
+		saved := newProgress()
+		if err := checkpoint.NewCheckpointer(path, 0).Write(saved); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		loaded, err := checkpoint.Load(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+
+		expectLoaded(t, saved, loaded)
+		if n := loaded.Result.Graph.Inbound("https://example.com/contact.html"); n != 1 {
+			t.Errorf("expected 1 page linking to contact.html, got %d", n)
+		}
+		page := loaded.Result.Pages["https://example.com/contact.html"]
+		if page == nil || page.Depth != 1 || page.StatusCode != 200 || page.Err != crawlers.ErrPageNotHTML {
+			t.Errorf("expected contact page to be restored, got %+v", page)
+		}
+		page = loaded.Result.Pages["https://example.com/docs.html"]
+		if page == nil || !errors.Is(page.Err, crawlers.ErrTimeout) || page.Outcome != crawlers.OutcomeTimeout {
+			t.Errorf("expected docs page to be restored with a timeout, got %+v", page)
+		}
+
+		if _, err := checkpoint.Load(filepath.Join(dir, "missing.state")); err == nil {
+			t.Error("expected error for missing state file, got nil")
+		}
+	})
+
+	t.Run("it should only append the pages processed since the last save", func(t *testing.T) {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "crawl.state")
+
+		saved := newProgress()
+		checkpointer := checkpoint.NewCheckpointer(path, 0)
+		if err := checkpointer.Write(saved); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		before, _ := ioutil.ReadFile(path)
+
+		saved.AddPage("https://example.com/about.html", 1, &crawlers.FetchResult{StatusCode: 200}, nil, nil)
+		saved.AddChild("https://example.com/about/team.html", true)
+		saved.Closer("https://example.com/docs.html")
+		if err := checkpointer.Write(saved); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		after, _ := ioutil.ReadFile(path)
+
+		if !bytes.HasPrefix(after, before) || bytes.Count(after[len(before):], []byte("\n")) != 1 {
+			t.Errorf("expected one line appended to %s, got %s", before, after)
+		}
+		loaded, err := checkpoint.Load(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		expectLoaded(t, saved, loaded)
+	})
+
+	t.Run("it should continue a state file cut short by an interrupted save", func(t *testing.T) {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "crawl.state")
+
+		saved := newProgress()
+		if err := checkpoint.NewCheckpointer(path, 0).Write(saved); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		f.WriteString(`{"Page":{"URL":"https://example.com/ab`)
+		f.Close()
+
+		resumed, err := checkpoint.Load(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		expectLoaded(t, saved, resumed)
+
+		// the resumed crawl is saved to a copy of the state file
+		copyPath := filepath.Join(dir, "copy.state")
+		resumed.AddPage("https://example.com/about.html", 1, &crawlers.FetchResult{StatusCode: 200}, nil, nil)
+		saved.AddPage("https://example.com/about.html", 1, &crawlers.FetchResult{StatusCode: 200}, nil, nil)
+		if err := checkpoint.NewCheckpointer(copyPath, 0).Write(resumed); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		loaded, err := checkpoint.Load(copyPath)
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		expectLoaded(t, saved, loaded)
+
+		// or to its own state file, whose incomplete line is dropped
+		resumed, err = checkpoint.Load(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		resumed.AddPage("https://example.com/about.html", 1, &crawlers.FetchResult{StatusCode: 200}, nil, nil)
+		if err := checkpoint.NewCheckpointer(path, 0).Write(resumed); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		loaded, err = checkpoint.Load(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		expectLoaded(t, saved, loaded)
+	})
+
+	t.Run("it should not take root urls when resuming a crawl", func(t *testing.T) {
+		viper.Set("RESUME", "crawl.state")
+		defer viper.Set("RESUME", "")
+		store, _ := frontier.Open(frontier.MemoryStorage, "", 0)
+		defer store.Close()
+
+		if _, err := checkpoint.Start([]string{"https://example.com"}, store, nil); !errors.Is(err, checkpoint.ErrResumeSeeds) {
+			t.Errorf("expected %s, got %v", checkpoint.ErrResumeSeeds, err)
+		}
+	})
+
+	t.Run("it should resume a crawl with memory and disk storage", func(t *testing.T) {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "crawl.state")
+
+		saved := newProgress()
+		if err := checkpoint.NewCheckpointer(path, 0).Write(saved); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		viper.Set("RESUME", path)
+		defer viper.Set("RESUME", "")
+
+		for _, name := range []string{"memory", "disk"} {
+			storage, _ := frontier.ParseStorage(name)
+			store, err := frontier.Open(storage, dir, 2)
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			pages := map[string]int{}
+			resumed, err := checkpoint.Start(nil, store, func(url string, depth int, fetched *crawlers.FetchResult, err error) {
+				pages[url] = depth
+			})
+			if err != nil {
+				t.Fatalf("%s : expected no error, got %s", name, err)
+			}
+
+			expectedPages := map[string]int{
+				"https://example.com":              0,
+				"https://example.com/contact.html": 1,
+				"https://example.com/docs.html":    1,
+			}
+			if !reflect.DeepEqual(expectedPages, pages) {
+				t.Errorf("%s : expected pages %v, got %v", name, expectedPages, pages)
+			}
+			if resumed.Processed != saved.Processed || resumed.Pages != saved.Pages || resumed.Failures != saved.Failures {
+				t.Errorf("%s : expected %d pages and %d failures, got %d and %d", name, saved.Pages, saved.Failures, resumed.Pages, resumed.Failures)
+			}
+			if name == "disk" && len(resumed.Result.Pages) != 0 {
+				t.Errorf("%s : expected no pages in memory, got %d", name, len(resumed.Result.Pages))
+			}
+
+			// only the pending url is queued again, at its depth
+			expected := frontier.Entry{URL: "https://example.com/about.html", Depth: 1}
+			if got, ok, _ := store.Frontier.Pop(); !ok || got != expected {
+				t.Errorf("%s : expected %v, got %v (ok %t)", name, expected, got, ok)
+			}
+			if got, ok, _ := store.Frontier.Pop(); ok {
+				t.Errorf("%s : expected empty frontier, got %v", name, got)
+			}
+			// a recorded url is seen but not queued, so it is queued when found in a followable element
+			if seen, _ := store.Visited.Contains("https://example.com/logo.png"); !seen {
+				t.Errorf("%s : expected logo.png to be seen", name)
+			}
+			if queued, _ := store.Queued.Contains("https://example.com/logo.png"); queued {
+				t.Errorf("%s : expected logo.png not to be queued", name)
+			}
+			if queued, _ := store.Queued.Contains("https://example.com/about.html"); !queued {
+				t.Errorf("%s : expected about.html to be queued", name)
+			}
+			store.Close()
+		}
+	})
+}
@@ -2,11 +2,15 @@ package concurrent
 
 import (
 	"context"
-	"strings"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers/checkpoint"
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers/frontier"
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers/politeness"
 	"github.com/nikhil-thomas/web-crawler/internal/sitemap"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -14,81 +18,167 @@ import (
 
 // CrawlManager implements sitemap.Crawler interface
 type CrawlManager struct {
-	fetcher    crawlers.URLFetcher
-	done       chan bool
-	cache      []string
-	supplyChan chan string
-	mu         sync.Mutex
+	fetcher  crawlers.PageFetcher
+	opts     crawlers.Options
+	done     chan bool
+	stopOnce sync.Once
+	// store holds the urls waiting to be passed to workers and the urls already seen
+	store *frontier.Store
+	// limiter spaces out and caps the requests workers make to each host
+	limiter *politeness.Limiter
+	// enqueuer tracks the goroutine reading from the frontier
+	enqueuer sync.WaitGroup
+	// mu guards err, the error which stopped the crawl
+	mu  sync.Mutex
+	err error
+	// queueLength is the number of urls handed to workers ahead of time
+	queueLength int
+	// pending counts urls which are queued, being fetched or being processed
+	// it is only changed by the goroutine which adds urls to the queue
+	pending int
 }
 
 // Page defines a HTML page and links inside the page
+// depth is the number of clicks from the nearest root url when the page was queued
 type Page struct {
 	url      string
-	children []string
+	depth    int
+	links    []crawlers.Link
+	children []crawlers.Link
+	// outOfScope holds the links out of scope of the crawl
+	outOfScope []crawlers.Link
+	result     *crawlers.FetchResult
+	err        error
 }
 
 // NewCrawlManager creates and returns a CrawlManager
-func NewCrawlManager(fetcher crawlers.URLFetcher) *CrawlManager {
+func NewCrawlManager(fetcher crawlers.URLFetcher, opts ...crawlers.Option) *CrawlManager {
 	queueLength := viper.GetInt("CRAWLER_QUEUE_LENGTH")
 	if queueLength == 0 {
 		queueLength = 2
 	}
 	return &CrawlManager{
-		fetcher:    fetcher,
-		done:       make(chan bool),
-		cache:      []string{},
-		supplyChan: make(chan string, queueLength),
+		fetcher:     crawlers.AdaptURLFetcher(fetcher),
+		opts:        crawlers.NewOptions(opts...),
+		done:        make(chan bool),
+		queueLength: queueLength,
 	}
 }
 
-func filterDomains(links []string, rootDomain string) []string {
-	var filteredLinks []string
-	for _, link := range links {
-		if link == "" {
-			continue
-		}
-		if strings.HasPrefix(link, rootDomain) {
-			filteredLinks = append(filteredLinks, link)
-		} else {
-			log.Info("skip   : ", link)
-		}
-	}
-	return filteredLinks
+// Crawl crawls webpages starting from one or more root urls and cretes sitemap
+// root urls share the visited urls and the scope of the crawl
+// cancelling ctx stops the crawl, pages being fetched are abandoned
+// and the sitemap crawled so far is returned with ctx.Err()
+// a crawl saved to a state file is continued when RESUME is set
+// with disk storage the returned result holds only the root urls, pages are passed to the page handler
+func (cm *CrawlManager) Crawl(ctx context.Context, rootURLs ...string) (*sitemap.Result, error) {
+	progress, err := cm.crawl(ctx, rootURLs...)
+	cm.opts.Finished(progress.Pages, progress.Failures, err)
+	return progress.Result, err
 }
 
-// Crawl crawls a webpage and cretes sitemap
-func (cm *CrawlManager) Crawl(rootURL string) (map[string]sitemap.Children, error) {
-	stmp := map[string]sitemap.Children{}
+func (cm *CrawlManager) crawl(ctx context.Context, rootURLs ...string) (*checkpoint.Progress, error) {
+	store, err := frontier.OpenConfigured()
+	if err != nil {
+		return checkpoint.NewProgress(nil), fmt.Errorf("crawl manager: %w", err)
+	}
+	defer store.Close()
+	cm.store = store
+	progress, err := checkpoint.Start(cm.opts.Seeds(rootURLs), store, cm.opts.OnPage)
+	if err != nil {
+		return checkpoint.NewProgress(nil), fmt.Errorf("crawl manager: %w", err)
+	}
+	seeds := progress.Result.Roots
 
-	PageChan := cm.enqueue()
+	// a resumed crawl may be complete or have reached the page limit already
+	cm.pending = store.Frontier.Len()
+	pageLimit := viper.GetInt("PAGE_LIMIT")
+	if cm.pending == 0 || (pageLimit != 0 && progress.Processed >= pageLimit) {
+		return progress, nil
+	}
+	// links out of scope are reported only once
+	outOfScope, err := store.NewSet("out-of-scope")
+	if err != nil {
+		return progress, fmt.Errorf("crawl manager: %w", err)
+	}
+	cm.limiter = politeness.NewConfiguredLimiter(cm.opts.Robots)
+
+	// fetchCtx is cancelled when the crawl stops for any reason
+	// so that workers do not wait for pages which will be discarded
+	fetchCtx, cancelFetch := context.WithCancel(ctx)
+	defer cancelFetch()
+	go func() {
+		select {
+		case <-ctx.Done():
+			log.Info("crawl  : cancelled : ", ctx.Err())
+			cm.StopCrawl()
+		case <-cm.done:
+		}
+		cancelFetch()
+	}()
 
-	linksChan := cm.launchWorkers(PageChan, rootURL)
+	PageChan := cm.enqueue()
 
-	sitemapChan := cm.makeSiteMap(linksChan, stmp)
+	linksChan := cm.launchWorkers(fetchCtx, PageChan, seeds)
 
-	// pass first input to pipeline
-	cm.addToQueue(rootURL)
+	sitemapChan := cm.makeSiteMap(fetchCtx, linksChan, progress, outOfScope)
 
 	// wait for final sitemmap map[string][]string
-	stmpOut := <-sitemapChan
+	<-sitemapChan
+	// the store is closed once nothing reads from it
+	cm.enqueuer.Wait()
 
-	return stmpOut, nil
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.err != nil {
+		return progress, cm.err
+	}
+	return progress, ctx.Err()
 }
 
+// fail stops the crawl because the frontier or the visited set failed
+// the first error is returned by Crawl
+func (cm *CrawlManager) fail(err error) {
+	log.Error("crawl  : ", err)
+	cm.mu.Lock()
+	if cm.err == nil {
+		cm.err = err
+	}
+	cm.mu.Unlock()
+	cm.StopCrawl()
+}
+
+// enqueue passes links from the frontier to the crawl pipeline
 func (cm *CrawlManager) enqueue() chan Page {
-	outChan := make(chan Page)
+	outChan := make(chan Page, cm.queueLength)
+	cm.enqueuer.Add(1)
 	go func() {
+		defer cm.enqueuer.Done()
 	forLoop:
 		for {
+			entry, ok, err := cm.store.Frontier.Pop()
+			if err != nil {
+				cm.fail(err)
+				break forLoop
+			}
+			if !ok {
+				// wait for new links
+				select {
+				case <-cm.done:
+					break forLoop
+				case <-cm.store.Frontier.Ready():
+					continue
+				}
+			}
+			page := Page{
+				url:      entry.URL,
+				depth:    entry.Depth,
+				children: nil,
+			}
 			select {
+			case outChan <- page:
 			case <-cm.done:
 				break forLoop
-			case link := <-cm.supplyChan:
-				page := Page{
-					url:      link,
-					children: nil,
-				}
-				outChan <- page
 			}
 		}
 		close(outChan)
@@ -96,26 +186,20 @@ func (cm *CrawlManager) enqueue() chan Page {
 	return outChan
 }
 
-func (cm *CrawlManager) addToQueue(url string) {
-	// add new links to input []string slice
-	// pass links to crawl pipeline only if input channel is not full
-	cm.mu.Lock()
-	cm.cache = append(cm.cache, url)
-	cm.mu.Unlock()
-
-	queueLength := viper.GetInt("CRAWLER_QUEUE_LENGTH")
-	if queueLength == 0 {
-		queueLength = 2
+// addToQueue pushes a link found depth clicks away from the nearest root url to the frontier
+// it never blocks
+func (cm *CrawlManager) addToQueue(url string, depth int) error {
+	if err := cm.store.Queued.Add(url); err != nil {
+		return err
 	}
-	if len(cm.supplyChan) < queueLength {
-		cm.supplyChan <- cm.cache[0]
-		cm.mu.Lock()
-		cm.cache = cm.cache[1:]
-		cm.mu.Unlock()
+	if err := cm.store.Frontier.Push(frontier.Entry{URL: url, Depth: depth}); err != nil {
+		return err
 	}
+	cm.pending++
+	return nil
 }
 
-func (cm *CrawlManager) launchWorkers(inChan chan Page, rootURL string) chan Page {
+func (cm *CrawlManager) launchWorkers(ctx context.Context, inChan chan Page, rootURLs []string) chan Page {
 
 	numWorkers := viper.GetInt("WORKER_COUNT")
 	if numWorkers == 0 {
@@ -125,7 +209,7 @@ func (cm *CrawlManager) launchWorkers(inChan chan Page, rootURL string) chan Pag
 
 	// Fan Out
 	for i := 0; i < numWorkers; i++ {
-		outChan := cm.extractWorker(inChan, i+1, rootURL)
+		outChan := cm.extractWorker(ctx, inChan, i+1, rootURLs)
 		outChanList = append(outChanList, outChan)
 	}
 
@@ -135,7 +219,7 @@ func (cm *CrawlManager) launchWorkers(inChan chan Page, rootURL string) chan Pag
 }
 
 // func extractWorker(inChan chan Page, outChan chan Page, fetcher crawlers.URLFetcher, rootURL string) chan Page {
-func (cm *CrawlManager) extractWorker(inChan chan Page, id int, rootURL string) chan Page {
+func (cm *CrawlManager) extractWorker(ctx context.Context, inChan chan Page, id int, rootURLs []string) chan Page {
 	outChan := make(chan Page)
 	go func() {
 	forLoop:
@@ -143,18 +227,31 @@ func (cm *CrawlManager) extractWorker(inChan chan Page, id int, rootURL string)
 			select {
 			case <-cm.done:
 				break forLoop
-			case page := <-inChan:
+			case page, ok := <-inChan:
+				if !ok {
+					break forLoop
+				}
 				if page.url != "" {
 					log.Debug("worker : ", id, " : url : ", page.url)
-					links, err := cm.fetcher.ExtractURLs(page.url)
-					if err != nil {
-						log.Error("crawl : ", err, page.url)
+					// robots.txt may have to be fetched, so it is checked by workers
+					if cm.opts.Allowed(ctx, page.url) {
+						page.result, page.err = cm.fetch(ctx, page.url)
 					} else {
-						page.children = filterDomains(links, rootURL)
+						page.err = crawlers.ErrDisallowedByRobots
+					}
+					if page.err != nil {
+						log.Error("crawl : ", page.err, page.url)
+					} else {
+						page.links = cm.opts.NormalizeLinks(page.result.Links)
+						page.children, page.outOfScope = cm.opts.FilterScope(page.links, rootURLs)
 					}
 				}
 
-				outChan <- page
+				select {
+				case outChan <- page:
+				case <-cm.done:
+					break forLoop
+				}
 			}
 		}
 		log.Debug("worker : exited : ", id)
@@ -163,50 +260,171 @@ func (cm *CrawlManager) extractWorker(inChan chan Page, id int, rootURL string)
 	return outChan
 }
 
-func (cm *CrawlManager) makeSiteMap(inChan chan Page, stmp map[string]sitemap.Children) chan map[string]sitemap.Children {
-	outSiteMapChan := make(chan map[string]sitemap.Children)
+// fetch fetches a page once the limiter allows a request to its host
+func (cm *CrawlManager) fetch(ctx context.Context, url string) (*crawlers.FetchResult, error) {
+	release, err := cm.limiter.Acquire(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	// retries wait on the limiter so that every worker backs off the host
+	return cm.fetcher.Fetch(crawlers.WithThrottle(ctx, cm.limiter), url)
+}
+
+// makeSiteMap adds the pages fetched by workers to the sitemap
+// ctx is cancelled when the crawl stops, pages received after that are not recorded
+// links out of scope are reported once they are added to outOfScope
+func (cm *CrawlManager) makeSiteMap(ctx context.Context, inChan chan Page, progress *checkpoint.Progress, outOfScope frontier.VisitedSet) chan *checkpoint.Progress {
+	outSiteMapChan := make(chan *checkpoint.Progress)
+	result := progress.Result
+	checkpointer := checkpoint.NewConfiguredCheckpointer()
+	visited, queued := cm.store.Visited, cm.store.Queued
 	linksPerPage := viper.GetInt("LINKS_PER_PAGE")
 	pageLimit := viper.GetInt("PAGE_LIMIT")
-
-	// queueEmptyTimeoutEvent trigger crawl stop
-	// when queue is empty for more than specified time duration
-	queueEmptyTimeoutEvent := make(chan bool)
-
-	// queueCloseCtx, queueCloseCancel are used
-	// to make sitemap generation safe to stop
-	// without causing duplicate channel closes
-	var queueCloseCtx context.Context
-	queueCloseCancel := func() {}
+	maxDepth := viper.GetInt("MAX_DEPTH")
+	// new urls are not added once maxURLs urls are seen
+	maxURLs := viper.GetInt("MAX_URLS")
+	// idleTimeout is an optional guard which stops the crawl
+	// when no page is completed for the specified time duration
+	idleTimeout := viper.GetDuration("CRAWLER_TIMEOUT")
 
 	go func() {
-		i := 0
+		// number of clicks from nearest root url of the urls reached through a shorter path
+		// after they were queued, it is empty with disk storage
+		depths := progress.Depths
+		// the url limit is reported only once
+		urlLimitReached := false
+		// idle fires when no page is completed for idleTimeout
+		// a single timer is restarted for every page
+		var idle <-chan time.Time
+		resetIdle := func() {}
+		if idleTimeout > 0 {
+			timer := time.NewTimer(idleTimeout)
+			defer timer.Stop()
+			idle = timer.C
+			resetIdle = func() {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(idleTimeout)
+			}
+		}
 	forLoop:
 		for {
 			select {
 			case <-cm.done:
 				break forLoop
-			case <-queueEmptyTimeoutEvent:
+			case <-idle:
+				log.Warn("crawl  : no page completed in ", idleTimeout, " : stop crawiling")
 				break forLoop
 			case page := <-inChan:
+				resetIdle()
+				// a fetch abandoned because of cancellation is not recorded,
+				// the page stays pending in the saved progress
+				if ctx.Err() != nil {
+					log.Debug("crawl  : discarded : ", page.url)
+					break forLoop
+				}
+				cm.pending--
+				depth := page.depth
+				if d, ok := depths[page.url]; ok {
+					depth = d
+				}
+				// urls disallowed by robots.txt are kept in sitemap without crawling
+				if errors.Is(page.err, crawlers.ErrDisallowedByRobots) {
+					progress.AddPage(page.url, depth, nil, page.err, nil)
+					cm.opts.Skip(page.url, page.err)
+					if cm.pending == 0 {
+						log.Info("crawl  : all links crawled : stop crawiling")
+						break forLoop
+					}
+					continue
+				}
+				failed := false
+				if page.url != "" {
+					progress.AddPage(page.url, depth, page.result, page.err, cm.opts.Linked(page.links))
+					cm.opts.Fetched(page.url, depth, page.result, page.err)
+					failed = crawlers.Classify(page.result, page.err).Failed()
+				}
+				for _, link := range page.outOfScope {
+					reported, err := outOfScope.Contains(link.URL)
+					if err == nil && !reported {
+						err = outOfScope.Add(link.URL)
+						cm.opts.OutOfScope(link.URL)
+					}
+					if err != nil {
+						cm.fail(err)
+						break forLoop
+					}
+				}
+				// links of pages at max depth are not expanded
+				// if maxDepth param is 0, then there is no limit
+				children := page.children
+				if maxDepth > 0 && depth >= maxDepth && len(children) > 0 {
+					log.Info("depth  : max depth (", maxDepth, ") reached : ", page.url)
+					children = nil
+				}
 				k := 0
-				for _, link := range page.children {
+				for _, link := range children {
+					action := cm.opts.Action(link)
+					if action == crawlers.Ignore {
+						continue
+					}
+					seen, err := visited.Contains(link.URL)
+					if err != nil {
+						cm.fail(err)
+						break forLoop
+					}
+					// workers finish pages out of order, so a shorter path
+					// to a page may be found before the page is crawled
+					if _, crawled := result.Pages[link.URL]; seen && !crawled && depths[link.URL] > depth+1 {
+						progress.Closer(link.URL)
+					}
+					// a recorded link is crawled once it is found in a followable element
+					upgrade := false
+					if seen && action == crawlers.Follow {
+						isQueued, err := queued.Contains(link.URL)
+						if err != nil {
+							cm.fail(err)
+							break forLoop
+						}
+						upgrade = !isQueued
+					}
 					// save link only if it is new
-					if _, ok := stmp[link]; !ok {
-						// append link to parents children slice
-						stmp[page.url] = append(stmp[page.url], link)
-						log.Info("add    : ", link)
-						// record link in sitemap for further crawling
-						stmp[link] = sitemap.Children{}
-
-						// push link to input queue
-						cm.addToQueue(link)
-
-						// if there is an active timeout
-						// because of empty queue cance it
-						// as queue is not empty anymore
-						queueCloseCancel()
-
-						k++
+					if !seen && maxURLs > 0 && visited.Len() >= maxURLs {
+						if !urlLimitReached {
+							log.Warn("crawl  : url limit (", maxURLs, ") reached : new urls are not added")
+							urlLimitReached = true
+						}
+						continue
+					}
+					if !seen || upgrade {
+						if !seen {
+							if err := visited.Add(link.URL); err != nil {
+								cm.fail(err)
+								break forLoop
+							}
+							// append link to parents children slice,
+							// recorded links are kept in sitemap without crawling
+							progress.AddChild(link.URL, action == crawlers.Follow)
+							log.Info("add    : ", link.URL)
+							cm.opts.Discovered(page.url, depth+1, link, action)
+							k++
+						} else {
+							progress.Queue(link.URL)
+						}
+
+						if action == crawlers.Follow {
+							// push link to input queue
+							if err := cm.addToQueue(link.URL, depth+1); err != nil {
+								cm.fail(err)
+								break forLoop
+							}
+						}
+
 						// process only specified number of links perpage
 						// if the linksPerPage == 0 process all links from the page
 						if linksPerPage > 0 && k >= linksPerPage {
@@ -214,54 +432,52 @@ func (cm *CrawlManager) makeSiteMap(inChan chan Page, stmp map[string]sitemap.Ch
 						}
 					}
 				}
-				i++
-				// print number of pages processed and
-				// number of links currently in the input queue
-				log.Info("links  : ", i, " : queue : ", len(cm.supplyChan))
+				// print number of pages processed, number of links
+				// currently in the frontier and number of links handed to workers
+				queued := cm.store.Frontier.Len()
+				log.Info("links  : ", progress.Processed, " : queue : ", queued, " : in flight : ", cm.pending-queued)
+				checkpointer.Tick(progress)
+
+				// failed pages of a resumed crawl count towards the error policy
+				if failed && cm.opts.OnError.Abort(progress.Failures) {
+					cm.fail(fmt.Errorf("crawl manager: %w : %v", crawlers.ErrTooManyErrors, page.err))
+					break forLoop
+				}
 
 				// if specified number pages are processed stop crawlling
 				// if pageLimit param is 0, then thre is no limit
 				// crawl till the queue is empty
-				if pageLimit != 0 && i >= pageLimit {
+				if pageLimit != 0 && progress.Processed >= pageLimit {
 					log.Info("crawl  : page limit (", pageLimit, ") reached : stop crawiling")
 					break forLoop
 				}
-				// if input queue is empty
-				// stop crawling if after specified timeout
-				if len(cm.supplyChan) == 0 {
-					queueCloseCancel()
-					queueCloseCtx, queueCloseCancel = context.WithCancel(context.Background())
-					go endOperationTimeout(queueCloseCtx, queueEmptyTimeoutEvent)
+				// crawl is finished when no link is queued,
+				// being fetched or waiting to be processed
+				if cm.pending == 0 {
+					log.Info("crawl  : all links crawled : stop crawiling")
+					break forLoop
 				}
 			}
 		}
 		// issue done signal for all pipeline stages
 		cm.StopCrawl()
-		outSiteMapChan <- stmp
+		// wait for in-flight workers to exit, their pages are discarded
+		for page := range inChan {
+			log.Debug("crawl  : discarded : ", page.url)
+		}
+		// discarded pages are still pending in the saved progress
+		checkpointer.Save(progress)
+		outSiteMapChan <- progress
 	}()
 	return outSiteMapChan
 }
 
-func endOperationTimeout(ctx context.Context, queueEmptyChan chan bool) {
-	timeout := viper.GetDuration("CRAWLER_TIMEOUT")
-	if timeout == time.Duration(0) {
-		timeout = 1 * time.Second
-	}
-	log.Info("queue  : empty : start crawiling stop timeout : ", timeout)
-	select {
-	case <-time.After(timeout):
-		log.Info("queue  : empty : stop crawiling")
-		close(queueEmptyChan)
-
-	// abort timeout if queue is not empty any more
-	case <-ctx.Done():
-		log.Info("queue  : empty : start crawiling stop timeout cancelled")
-	}
-}
-
 // StopCrawl stops crawling
+// it is safe to call StopCrawl more than once
 func (cm *CrawlManager) StopCrawl() {
-	close(cm.done)
+	cm.stopOnce.Do(func() {
+		close(cm.done)
+	})
 }
 
 func (cm *CrawlManager) merge(inChans ...chan Page) chan Page {
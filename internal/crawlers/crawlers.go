@@ -1,11 +1,300 @@
 package crawlers
 
-import "errors"
+import (
+	"context"
+	"net/http"
+	"time"
 
-// ErrPageNotHTML is returned when the fetched page is not HTML
-var ErrPageNotHTML = errors.New("page is not html")
+	log "github.com/sirupsen/logrus"
+)
 
 // URLFetcher defines extraction of links from an html page
 type URLFetcher interface {
 	ExtractURLs(url string) ([]string, error)
 }
+
+// FetchResult defines a fetched page, its response metadata and the links found in it
+// NoIndex and NoFollow are set by <meta name="robots"> or the X-Robots-Tag header
+// Title is the <title> of the page, Canonical is the url of its <link rel="canonical">
+// Retries is the number of failed requests made before the last one
+type FetchResult struct {
+	URL           string
+	FinalURL      string
+	StatusCode    int
+	ContentType   string
+	ContentLength int64
+	ResponseTime  time.Duration
+	Header        http.Header
+	NoIndex       bool
+	NoFollow      bool
+	Title         string
+	Canonical     string
+	Retries       int
+	Links         []Link
+}
+
+// PageFetcher defines fetching of a page along with its response metadata
+// a fetch is abandoned when ctx is cancelled
+type PageFetcher interface {
+	Fetch(ctx context.Context, url string) (*FetchResult, error)
+}
+
+// LinkChecker defines checking the status of a url without crawling it
+// the result holds the response metadata but no links
+type LinkChecker interface {
+	Check(ctx context.Context, url string) (*FetchResult, error)
+}
+
+// urlFetcherAdapter implements PageFetcher for a URLFetcher
+type urlFetcherAdapter struct {
+	fetcher URLFetcher
+}
+
+// Fetch returns the links extracted by the URLFetcher as anchor links
+// response metadata is not available from a URLFetcher
+// a URLFetcher cannot be cancelled, so ctx is only checked before the fetch
+func (ufa urlFetcherAdapter) Fetch(ctx context.Context, url string) (*FetchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	urls, err := ufa.fetcher.ExtractURLs(url)
+	if err != nil {
+		return nil, err
+	}
+	result := &FetchResult{
+		URL:      url,
+		FinalURL: url,
+	}
+	for _, u := range urls {
+		result.Links = append(result.Links, Link{URL: u, Element: "a", Attribute: "href"})
+	}
+	return result, nil
+}
+
+// AdaptURLFetcher returns a PageFetcher for a URLFetcher
+// fetchers which already implement PageFetcher are returned as they are
+func AdaptURLFetcher(fetcher URLFetcher) PageFetcher {
+	if pf, ok := fetcher.(PageFetcher); ok {
+		return pf
+	}
+	return urlFetcherAdapter{fetcher: fetcher}
+}
+
+// RobotsChecker defines the robots.txt rules applied before fetching a url
+type RobotsChecker interface {
+	Allowed(ctx context.Context, url string) bool
+	CrawlDelay(ctx context.Context, url string) time.Duration
+}
+
+// Throttle defines the request schedule a fetcher waits on before retrying a url
+type Throttle interface {
+	// Backoff postpones every request to the host of url by at least wait
+	// and waits for the turn of the retry, it returns ctx.Err() when ctx is cancelled
+	Backoff(ctx context.Context, url string, wait time.Duration) error
+}
+
+// throttleKey is the context key of the Throttle of a fetch
+type throttleKey struct{}
+
+// WithThrottle returns a copy of ctx which makes fetchers retry through throttle
+// so that a host asking to slow down is slowed down for every request
+func WithThrottle(ctx context.Context, throttle Throttle) context.Context {
+	return context.WithValue(ctx, throttleKey{}, throttle)
+}
+
+// ThrottleFrom returns the Throttle of ctx, nil when there is none
+func ThrottleFrom(ctx context.Context) Throttle {
+	throttle, _ := ctx.Value(throttleKey{}).(Throttle)
+	return throttle
+}
+
+// SkipHandler is called with every discovered url a crawler decides not to fetch
+type SkipHandler func(url string, reason error)
+
+// PageHandler is called with every page a crawler processes, fetched or failed
+// a resumed crawl passes the pages processed before it was resumed first
+type PageHandler func(url string, depth int, fetched *FetchResult, err error)
+
+// Options defines the optional behavior shared by crawl managers
+type Options struct {
+	Robots     RobotsChecker
+	OnSkip     SkipHandler
+	OnEvent    EventHandler
+	OnPage     PageHandler
+	LinkPolicy LinkPolicy
+	Normalizer *Normalizer
+	Scope      *Scope
+	OnError    ErrorPolicy
+}
+
+// Option configures Options
+type Option func(*Options)
+
+// NewOptions creates Options from a list of Option
+func NewOptions(opts ...Option) Options {
+	o := Options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.LinkPolicy == nil {
+		o.LinkPolicy = DefaultLinkPolicy()
+	}
+	if o.Normalizer == nil {
+		o.Normalizer = &Normalizer{}
+	}
+	if o.Scope == nil {
+		o.Scope = &Scope{}
+	}
+	return o
+}
+
+// WithRobots makes a crawl manager check robots.txt before queueing a url
+func WithRobots(robots RobotsChecker) Option {
+	return func(o *Options) {
+		o.Robots = robots
+	}
+}
+
+// WithLinkPolicy sets which links are followed and which are only recorded
+func WithLinkPolicy(policy LinkPolicy) Option {
+	return func(o *Options) {
+		o.LinkPolicy = policy
+	}
+}
+
+// WithNormalizer sets the Normalizer which canonicalizes urls before deduplication
+func WithNormalizer(normalizer *Normalizer) Option {
+	return func(o *Options) {
+		o.Normalizer = normalizer
+	}
+}
+
+// WithScope sets the Scope which decides which links are crawled
+func WithScope(scope *Scope) Option {
+	return func(o *Options) {
+		o.Scope = scope
+	}
+}
+
+// WithErrorPolicy sets when a crawl is aborted because of failed pages
+func WithErrorPolicy(policy ErrorPolicy) Option {
+	return func(o *Options) {
+		o.OnError = policy
+	}
+}
+
+// WithSkipHandler sets the function which reports skipped urls
+func WithSkipHandler(fn SkipHandler) Option {
+	return func(o *Options) {
+		o.OnSkip = fn
+	}
+}
+
+// WithEventHandler sets the function which receives the events of a crawl
+func WithEventHandler(fn EventHandler) Option {
+	return func(o *Options) {
+		o.OnEvent = fn
+	}
+}
+
+// WithPageHandler sets the function which receives the pages of a crawl
+// it lets pages be exported while the crawl runs when the sitemap is not kept in memory
+func WithPageHandler(fn PageHandler) Option {
+	return func(o *Options) {
+		o.OnPage = fn
+	}
+}
+
+// Allowed reports whether robots.txt allows fetching url
+func (o Options) Allowed(ctx context.Context, url string) bool {
+	return o.Robots == nil || o.Robots.Allowed(ctx, url)
+}
+
+// Action returns what a crawler does with a link
+// a nofollow link is recorded instead of being followed
+func (o Options) Action(link Link) LinkAction {
+	action := o.LinkPolicy.Action(link)
+	if action == Follow && link.NoFollow {
+		return Record
+	}
+	return action
+}
+
+// NormalizeLinks returns links with canonical urls
+func (o Options) NormalizeLinks(links []Link) []Link {
+	normalized := make([]Link, 0, len(links))
+	for _, link := range links {
+		link.URL = o.Normalizer.Normalize(link.URL)
+		normalized = append(normalized, link)
+	}
+	return normalized
+}
+
+// Linked returns the links a crawler keeps track of, links ignored by the link policy are dropped
+func (o Options) Linked(links []Link) []Link {
+	var linked []Link
+	for _, link := range links {
+		if link.URL != "" && o.LinkPolicy.Action(link) != Ignore {
+			linked = append(linked, link)
+		}
+	}
+	return linked
+}
+
+// Seeds returns the canonical form of the root urls of a crawl
+// duplicate root urls are dropped
+func (o Options) Seeds(rootURLs []string) []string {
+	var seeds []string
+	seen := map[string]bool{}
+	for _, rootURL := range rootURLs {
+		rootURL = o.Normalizer.Normalize(rootURL)
+		if rootURL == "" || seen[rootURL] {
+			continue
+		}
+		seen[rootURL] = true
+		seeds = append(seeds, rootURL)
+	}
+	return seeds
+}
+
+// FilterScope splits links into the links in scope of a crawl started from rootURLs
+// and the links out of scope
+// a link is in scope if it is in scope of any of the root urls
+func (o Options) FilterScope(links []Link, rootURLs []string) (inScope, outOfScope []Link) {
+	for _, link := range links {
+		if link.URL == "" {
+			continue
+		}
+		if o.InScope(link.URL, rootURLs) {
+			inScope = append(inScope, link)
+		} else {
+			outOfScope = append(outOfScope, link)
+		}
+	}
+	return inScope, outOfScope
+}
+
+// OutOfScope reports a url which is not fetched because it is out of scope of the crawl
+func (o Options) OutOfScope(url string) {
+	log.Info("skip   : ", url)
+	o.Emit(Event{Type: EventLinkSkipped, URL: url, Reason: "out of scope"})
+}
+
+// InScope reports whether url is in scope of a crawl started from rootURLs
+func (o Options) InScope(url string, rootURLs []string) bool {
+	for _, rootURL := range rootURLs {
+		if o.Scope.Contains(url, rootURL) {
+			return true
+		}
+	}
+	return false
+}
+
+// Skip reports a url which will not be fetched
+func (o Options) Skip(url string, reason error) {
+	log.Warn("skip   : ", reason, " : ", url)
+	o.Emit(Event{Type: EventLinkSkipped, URL: url, Reason: reason.Error()})
+	if o.OnSkip != nil {
+		o.OnSkip(url, reason)
+	}
+}
@@ -0,0 +1,79 @@
+package crawlers
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPageNotHTML is returned when the fetched page is not HTML
+var ErrPageNotHTML = errors.New("page is not html")
+
+// ErrDisallowedByRobots is returned when robots.txt does not allow fetching a url
+var ErrDisallowedByRobots = errors.New("disallowed by robots.txt")
+
+// ErrTooManyErrors is returned when a crawl is aborted by its ErrorPolicy
+var ErrTooManyErrors = errors.New("too many failed pages")
+
+// errors a fetch fails with, they are matched with errors.Is
+var (
+	// ErrTimeout is a request which timed out
+	ErrTimeout = errors.New("request timed out")
+	// ErrDNS is a host name which could not be resolved
+	ErrDNS = errors.New("host name not resolved")
+	// ErrConnectionRefused is a connection refused by the server
+	ErrConnectionRefused = errors.New("connection refused")
+	// ErrTLS is a failed tls handshake or an invalid server certificate
+	ErrTLS = errors.New("tls failure")
+	// ErrBodyTooLarge is a response body larger than the fetcher accepts
+	ErrBodyTooLarge = errors.New("response body too large")
+	// ErrRedirectLoop is a redirect back to a url already visited, or too many redirects
+	ErrRedirectLoop = errors.New("redirect loop")
+)
+
+// StatusError is returned when the server responds with an error status code
+// it is matched with errors.As
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (se *StatusError) Error() string {
+	return fmt.Sprintf("status code : %d : url : %s", se.StatusCode, se.URL)
+}
+
+// FetchError defines a request which failed before a complete response was received
+// Kind is the error of the taxonomy the failure belongs to, nil when it belongs to none
+// errors.Is matches both Kind and Err
+type FetchError struct {
+	URL  string
+	Kind error
+	Err  error
+}
+
+func (fe *FetchError) Error() string {
+	return fmt.Sprintf("fetch : url : %s : err : %v", fe.URL, fe.Err)
+}
+
+// Unwrap returns the error the request failed with
+func (fe *FetchError) Unwrap() error {
+	return fe.Err
+}
+
+// Is reports whether the failure is of kind target
+func (fe *FetchError) Is(target error) bool {
+	return fe.Kind != nil && fe.Kind == target
+}
+
+// RestoreError returns the error of a page saved with its outcome and error message
+// the error matches the errors of the taxonomy as it did before it was saved
+func RestoreError(url string, outcome Outcome, statusCode int, msg string) error {
+	switch kind := outcome.Err(); {
+	case outcome == OutcomeHTTPError:
+		return &StatusError{URL: url, StatusCode: statusCode}
+	case kind != nil && msg == kind.Error():
+		return kind
+	case kind != nil:
+		return &FetchError{URL: url, Kind: kind, Err: errors.New(msg)}
+	}
+	return errors.New(msg)
+}
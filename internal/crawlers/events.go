@@ -0,0 +1,151 @@
+package crawlers
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// EventType names what happened during a crawl
+type EventType string
+
+const (
+	// EventPageFetched is a page fetched, html or not
+	EventPageFetched EventType = "page_fetched"
+	// EventLinkDiscovered is a url found for the first time in a crawled page
+	EventLinkDiscovered EventType = "link_discovered"
+	// EventLinkSkipped is a url which will not be fetched
+	EventLinkSkipped EventType = "link_skipped"
+	// EventError is a page whose fetch failed
+	EventError EventType = "error"
+	// EventCrawlFinished is the end of a crawl, complete or not
+	EventCrawlFinished EventType = "crawl_finished"
+)
+
+// Event defines something which happened during a crawl
+// only the fields which apply to the type of the event are set
+// Depth, Pages and Failures are pointers since 0 is a meaningful value for them
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	URL  string    `json:"url,omitempty"`
+	// Depth is the number of clicks from the nearest root url
+	Depth *int `json:"depth,omitempty"`
+	// Source is the page a discovered link was found in
+	Source  string `json:"source,omitempty"`
+	Element string `json:"element,omitempty"`
+	Text    string `json:"text,omitempty"`
+	// Action is follow or record for a discovered link
+	Action         string  `json:"action,omitempty"`
+	StatusCode     int     `json:"status_code,omitempty"`
+	Outcome        Outcome `json:"outcome,omitempty"`
+	ContentType    string  `json:"content_type,omitempty"`
+	Title          string  `json:"title,omitempty"`
+	Links          int     `json:"links,omitempty"`
+	ResponseTimeMS float64 `json:"response_time_ms,omitempty"`
+	// Reason is why a link was skipped
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Pages and Failures are the number of pages and failed pages of a finished crawl
+	Pages    *int `json:"pages,omitempty"`
+	Failures *int `json:"failures,omitempty"`
+}
+
+// EventHandler is called with every event of a crawl
+// the concurrent crawl manager calls it from several goroutines
+type EventHandler func(Event)
+
+// EventWriter writes events to w as newline delimited json, one event per line
+// every event is written as soon as it happens, so a partial crawl leaves complete lines
+// it is safe for concurrent use
+type EventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewEventWriter creates and returns an EventWriter writing to w
+func NewEventWriter(w io.Writer) *EventWriter {
+	return &EventWriter{enc: json.NewEncoder(w)}
+}
+
+// Handle writes an event, it is an EventHandler
+// events are dropped after the first write error
+func (ew *EventWriter) Handle(event Event) {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	if ew.err != nil {
+		return
+	}
+	ew.err = ew.enc.Encode(event)
+}
+
+// Err returns the first error writing events failed with
+func (ew *EventWriter) Err() error {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	return ew.err
+}
+
+// Emit passes an event to the event handler, its time is set when it is zero
+func (o Options) Emit(event Event) {
+	if o.OnEvent == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	o.OnEvent(event)
+}
+
+// Fetched reports the fetch of a url found depth clicks away from the nearest root url
+// a failed fetch is reported as an error event, the page is passed to the page handler
+func (o Options) Fetched(url string, depth int, fetched *FetchResult, err error) {
+	if o.OnPage != nil {
+		o.OnPage(url, depth, fetched, err)
+	}
+	event := Event{
+		Type:    EventPageFetched,
+		URL:     url,
+		Depth:   &depth,
+		Outcome: Classify(fetched, err),
+	}
+	if event.Outcome.Failed() {
+		event.Type = EventError
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	if fetched != nil {
+		event.StatusCode = fetched.StatusCode
+		event.ContentType = fetched.ContentType
+		event.Title = fetched.Title
+		event.Links = len(fetched.Links)
+		event.ResponseTimeMS = float64(fetched.ResponseTime) / float64(time.Millisecond)
+	}
+	o.Emit(event)
+}
+
+// Discovered reports a link found for the first time in the page source
+func (o Options) Discovered(source string, depth int, link Link, action LinkAction) {
+	o.Emit(Event{
+		Type:    EventLinkDiscovered,
+		URL:     link.URL,
+		Depth:   &depth,
+		Source:  source,
+		Element: link.Element,
+		Text:    link.Text,
+		Action:  action.String(),
+	})
+}
+
+// Finished reports the end of a crawl with its number of pages and failed pages
+// err is the error the crawl stopped with, nil when it was not interrupted
+func (o Options) Finished(pages, failures int, err error) {
+	event := Event{Type: EventCrawlFinished, Pages: &pages, Failures: &failures}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	o.Emit(event)
+}
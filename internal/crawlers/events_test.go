@@ -0,0 +1,50 @@
+package crawlers_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+)
+
+func TestEventWriter(t *testing.T) {
+	var buf bytes.Buffer
+	events := crawlers.NewEventWriter(&buf)
+	opts := crawlers.NewOptions(crawlers.WithEventHandler(events.Handle))
+
+	opts.Fetched("https://example.com", 0, &crawlers.FetchResult{StatusCode: 200}, nil)
+	opts.OutOfScope("https://other.com")
+	opts.Finished(1, 0, nil)
+
+	if err := events.Err(); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 events, got %q", buf.String())
+	}
+
+	t.Run("it should write the depth of root urls", func(t *testing.T) {
+		if !strings.Contains(lines[0], `"depth":0`) {
+			t.Errorf("expected depth 0, got %s", lines[0])
+		}
+	})
+
+	t.Run("it should leave out the fields which do not apply", func(t *testing.T) {
+		for _, field := range []string{`"depth"`, `"pages"`, `"failures"`} {
+			if strings.Contains(lines[1], field) {
+				t.Errorf("expected no %s, got %s", field, lines[1])
+			}
+		}
+	})
+
+	t.Run("it should write the counts of a crawl without failures", func(t *testing.T) {
+		if !strings.Contains(lines[2], `"pages":1`) || !strings.Contains(lines[2], `"failures":0`) {
+			t.Errorf("expected 1 page and 0 failures, got %s", lines[2])
+		}
+		if strings.Contains(lines[2], `"depth"`) {
+			t.Errorf("expected no depth, got %s", lines[2])
+		}
+	})
+}
@@ -0,0 +1,179 @@
+package frontier
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Disk is an unbounded first in first out queue of urls kept in a log file
+// pushed entries are appended to the log, popped entries are read from it in batches
+// of at most memoryLimit entries, the log is truncated whenever the frontier is empty
+type Disk struct {
+	mu          sync.Mutex
+	file        *os.File
+	w           *bufio.Writer
+	readOffset  int64
+	writeOffset int64
+	// batch holds entries read from the log which are not popped yet
+	batch       []Entry
+	memoryLimit int
+	n           int
+	ready       chan struct{}
+}
+
+// NewDisk creates and returns an empty Disk frontier with its log file in dir
+func NewDisk(dir string, memoryLimit int) (*Disk, error) {
+	file, err := os.OpenFile(filepath.Join(dir, "frontier.log"), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("frontier : %s", err)
+	}
+	if memoryLimit <= 0 {
+		memoryLimit = DefaultMemoryLimit
+	}
+	return &Disk{
+		file:        file,
+		w:           bufio.NewWriter(file),
+		memoryLimit: memoryLimit,
+		ready:       make(chan struct{}, 1),
+	}, nil
+}
+
+// Push appends entries to the end of the frontier
+// entries are written one per line as their depth followed by their url,
+// so urls must not contain line breaks
+func (d *Disk) Push(entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	d.mu.Lock()
+	for _, entry := range entries {
+		if strings.ContainsAny(entry.URL, "\r\n") {
+			d.mu.Unlock()
+			return fmt.Errorf("frontier : url contains a line break : %q", entry.URL)
+		}
+		n, err := d.w.WriteString(strconv.Itoa(entry.Depth) + " " + entry.URL + "\n")
+		d.writeOffset += int64(n)
+		if err != nil {
+			d.mu.Unlock()
+			return fmt.Errorf("frontier : %s", err)
+		}
+		d.n++
+	}
+	d.mu.Unlock()
+
+	signal(d.ready)
+	return nil
+}
+
+// Pop removes and returns the entry at the front of the frontier
+// ok is false when the frontier is empty
+func (d *Disk) Pop() (entry Entry, ok bool, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.n == 0 {
+		return Entry{}, false, nil
+	}
+	if len(d.batch) == 0 {
+		if err := d.readBatch(); err != nil {
+			return Entry{}, false, err
+		}
+	}
+	entry, d.batch = d.batch[0], d.batch[1:]
+	d.n--
+	// nothing is left to read, the log can be reused from the start
+	if d.n == 0 {
+		if err := d.truncate(); err != nil {
+			return entry, true, err
+		}
+	}
+	return entry, true, nil
+}
+
+// readBatch reads the next entries of the log into batch
+func (d *Disk) readBatch() error {
+	if err := d.w.Flush(); err != nil {
+		return fmt.Errorf("frontier : %s", err)
+	}
+	r := bufio.NewReader(io.NewSectionReader(d.file, d.readOffset, d.writeOffset-d.readOffset))
+	d.batch = make([]Entry, 0, minInt(d.n, d.memoryLimit))
+	for len(d.batch) < d.memoryLimit {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("frontier : %s", err)
+		}
+		d.readOffset += int64(len(line))
+		entry, err := parseEntry(strings.TrimSuffix(line, "\n"))
+		if err != nil {
+			return err
+		}
+		d.batch = append(d.batch, entry)
+	}
+	if len(d.batch) == 0 {
+		return fmt.Errorf("frontier : %d urls missing from log", d.n)
+	}
+	return nil
+}
+
+// parseEntry parses a line of the log
+func parseEntry(line string) (Entry, error) {
+	i := strings.IndexByte(line, ' ')
+	if i < 0 {
+		return Entry{}, fmt.Errorf("frontier : invalid log line : %q", line)
+	}
+	depth, err := strconv.Atoi(line[:i])
+	if err != nil {
+		return Entry{}, fmt.Errorf("frontier : invalid log line : %q", line)
+	}
+	return Entry{URL: line[i+1:], Depth: depth}, nil
+}
+
+func (d *Disk) truncate() error {
+	if err := d.w.Flush(); err != nil {
+		return fmt.Errorf("frontier : %s", err)
+	}
+	if err := d.file.Truncate(0); err != nil {
+		return fmt.Errorf("frontier : %s", err)
+	}
+	if _, err := d.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("frontier : %s", err)
+	}
+	d.readOffset, d.writeOffset = 0, 0
+	d.batch = nil
+	return nil
+}
+
+// Len returns the number of urls in the frontier
+func (d *Disk) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.n
+}
+
+// Ready returns a channel which receives a value after urls are pushed
+// Ready wakes up a single consumer
+func (d *Disk) Ready() <-chan struct{} {
+	return d.ready
+}
+
+// Close closes the log file
+func (d *Disk) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.file.Close()
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
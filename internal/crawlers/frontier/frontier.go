@@ -0,0 +1,231 @@
+package frontier
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// Entry defines a url waiting to be crawled
+// Depth is the number of clicks from the nearest root url when the url was queued
+type Entry struct {
+	URL   string
+	Depth int
+}
+
+// Frontier defines the queue of urls waiting to be crawled
+// implementations are safe for concurrent producers and a single consumer
+type Frontier interface {
+	// Push appends entries to the end of the frontier, it never blocks on consumers
+	Push(entries ...Entry) error
+	// Pop removes and returns the entry at the front of the frontier
+	// ok is false when the frontier is empty
+	Pop() (entry Entry, ok bool, err error)
+	// Len returns the number of urls in the frontier
+	Len() int
+	// Ready returns a channel which receives a value after urls are pushed
+	// a consumer finding the frontier empty waits on Ready before calling Pop again
+	Ready() <-chan struct{}
+	// Close releases the resources held by the frontier
+	Close() error
+}
+
+// Storage defines where the frontier and the url sets of a crawl are kept
+type Storage int
+
+const (
+	// MemoryStorage keeps the frontier and the url sets in memory
+	MemoryStorage Storage = iota
+	// DiskStorage keeps the frontier and the url sets on disk
+	// with a bounded number of urls in memory
+	// the crawl does not build the sitemap, the page metadata and the links in memory,
+	// pages are passed to the page handler of the crawl as they are processed
+	DiskStorage
+)
+
+// ParseStorage returns the Storage named memory or disk
+func ParseStorage(name string) (Storage, error) {
+	switch strings.ToLower(name) {
+	case "", "memory":
+		return MemoryStorage, nil
+	case "disk":
+		return DiskStorage, nil
+	}
+	return MemoryStorage, fmt.Errorf("storage : %q : expected memory or disk", name)
+}
+
+// DefaultMemoryLimit is the number of urls disk storage keeps in memory
+const DefaultMemoryLimit = 100000
+
+// Store holds the frontier and the url sets of a crawl
+// Visited holds the urls seen, Queued the urls pushed to the frontier
+type Store struct {
+	Storage  Storage
+	Frontier Frontier
+	Visited  VisitedSet
+	Queued   VisitedSet
+	// dir holds the files of disk storage, it is removed on Close
+	dir         string
+	memoryLimit int
+	// sets are closed on Close
+	sets []VisitedSet
+}
+
+// Open creates the frontier and the url sets of a crawl
+// disk storage keeps its files in a new directory inside dir (the system temporary directory when empty)
+// memoryLimit is the number of urls disk storage keeps in memory (0 means DefaultMemoryLimit)
+func Open(storage Storage, dir string, memoryLimit int) (*Store, error) {
+	s := &Store{Storage: storage, memoryLimit: memoryLimit}
+	if storage == MemoryStorage {
+		s.Frontier = NewMemory()
+	} else {
+		if s.memoryLimit <= 0 {
+			s.memoryLimit = DefaultMemoryLimit
+		}
+		var err error
+		s.dir, err = ioutil.TempDir(dir, "web-crawler-")
+		if err != nil {
+			return nil, fmt.Errorf("storage : %s", err)
+		}
+		s.Frontier, err = NewDisk(s.dir, s.memoryLimit)
+		if err != nil {
+			os.RemoveAll(s.dir)
+			return nil, err
+		}
+	}
+	var err error
+	if s.Visited, err = s.NewSet("visited"); err == nil {
+		s.Queued, err = s.NewSet("queued")
+	}
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewSet creates an empty url set kept like the other sets of the store, it is closed with the store
+// the files of a disk set are kept in a directory of the store named name
+func (s *Store) NewSet(name string) (VisitedSet, error) {
+	if s.Storage == MemoryStorage {
+		set := NewMemorySet()
+		s.sets = append(s.sets, set)
+		return set, nil
+	}
+	dir := filepath.Join(s.dir, name)
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return nil, fmt.Errorf("storage : %s", err)
+	}
+	set := NewDiskSet(dir, s.memoryLimit)
+	s.sets = append(s.sets, set)
+	return set, nil
+}
+
+// OpenConfigured opens the store selected by the STORAGE, STORAGE_DIR
+// and STORAGE_MEMORY_LIMIT configuration, memory storage is the default
+func OpenConfigured() (*Store, error) {
+	storage, err := ParseStorage(viper.GetString("STORAGE"))
+	if err != nil {
+		return nil, err
+	}
+	return Open(storage, viper.GetString("STORAGE_DIR"), viper.GetInt("STORAGE_MEMORY_LIMIT"))
+}
+
+// Close closes the frontier and the url sets and removes the files of disk storage
+func (s *Store) Close() error {
+	err := s.Frontier.Close()
+	for _, set := range s.sets {
+		if serr := set.Close(); err == nil {
+			err = serr
+		}
+	}
+	if s.dir != "" {
+		if rerr := os.RemoveAll(s.dir); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// Memory is an unbounded first in first out queue of urls waiting to be crawled
+// Memory is safe for concurrent producers, Push never blocks and never drops urls
+type Memory struct {
+	mu      sync.Mutex
+	entries []Entry
+	head    int
+	ready   chan struct{}
+}
+
+// NewMemory creates and returns an empty Memory frontier
+func NewMemory() *Memory {
+	return &Memory{
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// Push appends entries to the end of the frontier
+func (m *Memory) Push(entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	m.entries = append(m.entries, entries...)
+	m.mu.Unlock()
+
+	signal(m.ready)
+	return nil
+}
+
+// Pop removes and returns the entry at the front of the frontier
+// ok is false when the frontier is empty
+func (m *Memory) Pop() (entry Entry, ok bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.head == len(m.entries) {
+		return Entry{}, false, nil
+	}
+	entry = m.entries[m.head]
+	m.entries[m.head] = Entry{}
+	m.head++
+	// release the popped part of the slice once it is half of it
+	if m.head == len(m.entries) {
+		m.entries, m.head = m.entries[:0], 0
+	} else if m.head > len(m.entries)/2 {
+		m.entries, m.head = append([]Entry(nil), m.entries[m.head:]...), 0
+	}
+	return entry, true, nil
+}
+
+// Len returns the number of urls in the frontier
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries) - m.head
+}
+
+// Ready returns a channel which receives a value after urls are pushed
+// Ready wakes up a single consumer
+func (m *Memory) Ready() <-chan struct{} {
+	return m.ready
+}
+
+// Close empties the frontier
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries, m.head = nil, 0
+	return nil
+}
+
+// signal wakes up a consumer waiting on ready without blocking the producer
+func signal(ready chan struct{}) {
+	select {
+	case ready <- struct{}{}:
+	default:
+	}
+}
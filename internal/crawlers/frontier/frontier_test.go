@@ -0,0 +1,208 @@
+package frontier_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers/frontier"
+)
+
+// frontiers returns a memory frontier and a disk frontier
+// keeping only a few urls in memory, to run the same tests on both
+func frontiers(t *testing.T) (map[string]frontier.Frontier, func()) {
+	dir, err := ioutil.TempDir("", "frontier-test-")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	disk, err := frontier.NewDisk(dir, 3)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	fs := map[string]frontier.Frontier{
+		"memory": frontier.NewMemory(),
+		"disk":   disk,
+	}
+	return fs, func() {
+		for _, f := range fs {
+			f.Close()
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFrontier(t *testing.T) {
+	t.Run("it should pop urls in the order they were pushed", func(t *testing.T) {
+		fs, cleanup := frontiers(t)
+		defer cleanup()
+
+		for name, f := range fs {
+			var expected []frontier.Entry
+			for i := 0; i < 10; i++ {
+				entry := frontier.Entry{URL: fmt.Sprintf("https://example.com/%d.html", i), Depth: i / 3}
+				expected = append(expected, entry)
+				if err := f.Push(entry); err != nil {
+					t.Fatalf("%s : expected no error, got %s", name, err)
+				}
+				// pop some urls while others are pushed
+				if i%4 == 3 {
+					got, ok, err := f.Pop()
+					if err != nil || !ok || got != expected[0] {
+						t.Errorf("%s : expected %v, got %v (ok %t, err %v)", name, expected[0], got, ok, err)
+					}
+					expected = expected[1:]
+				}
+			}
+
+			if f.Len() != len(expected) {
+				t.Errorf("%s : expected %d urls, got %d", name, len(expected), f.Len())
+			}
+
+			for _, want := range expected {
+				got, ok, err := f.Pop()
+				if err != nil || !ok || got != want {
+					t.Errorf("%s : expected %v, got %v (ok %t, err %v)", name, want, got, ok, err)
+				}
+			}
+
+			if got, ok, _ := f.Pop(); ok {
+				t.Errorf("%s : expected empty frontier, got %v", name, got)
+			}
+
+			// an emptied frontier is reused
+			f.Push(frontier.Entry{URL: "https://example.com"})
+			if got, ok, _ := f.Pop(); !ok || got.URL != "https://example.com" {
+				t.Errorf("%s : expected https://example.com, got %v (ok %t)", name, got, ok)
+			}
+		}
+	})
+
+	t.Run("it should signal ready after a push", func(t *testing.T) {
+		fs, cleanup := frontiers(t)
+		defer cleanup()
+
+		for name, f := range fs {
+			select {
+			case <-f.Ready():
+				t.Errorf("%s : expected no ready signal for an empty frontier", name)
+			default:
+			}
+
+			go f.Push(frontier.Entry{URL: "https://example.com"})
+
+			select {
+			case <-f.Ready():
+			case <-time.After(time.Second):
+				t.Fatalf("%s : expected ready signal after push", name)
+			}
+			if got, ok, _ := f.Pop(); !ok || got.URL != "https://example.com" {
+				t.Errorf("%s : expected https://example.com, got %v (ok %t)", name, got, ok)
+			}
+		}
+	})
+
+	t.Run("it should not lose urls pushed by concurrent producers", func(t *testing.T) {
+		fs, cleanup := frontiers(t)
+		defer cleanup()
+
+		for name, f := range fs {
+			producers, perProducer := 8, 500
+			total := producers * perProducer
+
+			var wg sync.WaitGroup
+			wg.Add(producers)
+			for p := 0; p < producers; p++ {
+				go func(p int) {
+					defer wg.Done()
+					for i := 0; i < perProducer; i++ {
+						f.Push(frontier.Entry{URL: fmt.Sprintf("https://example.com/%d/%d", p, i), Depth: i})
+					}
+				}(p)
+			}
+
+			// a single consumer pops while producers are pushing
+			got := map[string]bool{}
+			done := make(chan bool)
+			go func() {
+				defer close(done)
+				for len(got) < total {
+					entry, ok, err := f.Pop()
+					if err != nil {
+						t.Errorf("%s : expected no error, got %s", name, err)
+						return
+					}
+					if !ok {
+						select {
+						case <-f.Ready():
+						case <-time.After(time.Second):
+							return
+						}
+						continue
+					}
+					if got[entry.URL] {
+						t.Errorf("%s : url popped twice : %s", name, entry.URL)
+					}
+					got[entry.URL] = true
+				}
+			}()
+
+			wg.Wait()
+			<-done
+
+			if len(got) != total {
+				t.Errorf("%s : expected %d urls, got %d", name, total, len(got))
+			}
+			if f.Len() != 0 {
+				t.Errorf("%s : expected empty frontier, got %d urls", name, f.Len())
+			}
+		}
+	})
+
+	t.Run("it should open the selected storage and remove its files on close", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "frontier-test-")
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		storage, err := frontier.ParseStorage("disk")
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		store, err := frontier.Open(storage, dir, 2)
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		crawled, err := store.NewSet("crawled")
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		for i := 0; i < 5; i++ {
+			url := fmt.Sprintf("https://example.com/%d.html", i)
+			store.Frontier.Push(frontier.Entry{URL: url})
+			store.Visited.Add(url)
+			crawled.Add(url)
+		}
+		// sets of one store keep their urls apart
+		if store.Queued.Len() != 0 || crawled.Len() != 5 {
+			t.Errorf("expected 0 queued and 5 crawled urls, got %d and %d", store.Queued.Len(), crawled.Len())
+		}
+		if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+			t.Errorf("expected a store directory, got %d files", len(files))
+		}
+
+		if err := store.Close(); err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+		if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+			t.Errorf("expected store files to be removed, got %d files", len(files))
+		}
+
+		if _, err := frontier.ParseStorage("cloud"); err == nil {
+			t.Error("expected error for unknown storage, got nil")
+		}
+	})
+}
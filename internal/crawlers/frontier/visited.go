@@ -0,0 +1,441 @@
+package frontier
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// VisitedSet defines the set of urls already seen by a crawl
+type VisitedSet interface {
+	// Add adds url to the set
+	Add(url string) error
+	// Contains reports whether url was added to the set
+	Contains(url string) (bool, error)
+	// Len returns the number of urls in the set
+	Len() int
+	// Close releases the resources held by the set
+	Close() error
+}
+
+// MemorySet is a VisitedSet kept in memory
+type MemorySet struct {
+	mu   sync.Mutex
+	urls map[string]bool
+}
+
+// NewMemorySet creates and returns an empty MemorySet
+func NewMemorySet() *MemorySet {
+	return &MemorySet{urls: map[string]bool{}}
+}
+
+// Add adds url to the set
+func (ms *MemorySet) Add(url string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.urls[url] = true
+	return nil
+}
+
+// Contains reports whether url was added to the set
+func (ms *MemorySet) Contains(url string) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.urls[url], nil
+}
+
+// Len returns the number of urls in the set
+func (ms *MemorySet) Len() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return len(ms.urls)
+}
+
+// Close empties the set
+func (ms *MemorySet) Close() error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.urls = map[string]bool{}
+	return nil
+}
+
+// mergeFactor is the number of runs of a level a DiskSet merges into one run of the next level
+const mergeFactor = 4
+
+// DiskSet is a VisitedSet which keeps urls on disk
+// urls are added to memory and written as a sorted run once memoryLimit urls
+// are in memory, mergeFactor runs of a level are merged into one run of the next level,
+// so every url is rewritten once per level and the number of runs grows
+// with the logarithm of the number of urls
+// runs are sorted by the 64 bit FNV-1a hash of the urls and hold the urls themselves,
+// urls with the same hash are told apart by comparing them
+type DiskSet struct {
+	mu          sync.Mutex
+	dir         string
+	memoryLimit int
+	memory      map[string]bool
+	// runs are ordered from the oldest to the newest, their levels never increase
+	runs []*run
+	seq  int
+	n    int
+}
+
+// run is a sorted set of urls kept in two files
+// the index holds a (hash, offset) entry per url sorted by hash and url,
+// the data holds the urls in the same order, each after its length
+type run struct {
+	index *os.File
+	data  *os.File
+	n     int64
+	// size is the size of the data
+	size  int64
+	level int
+}
+
+const (
+	// indexEntrySize is the size of a (hash, offset) entry of a run index
+	indexEntrySize = 16
+	// lengthSize is the size of the length written before every url of a run
+	lengthSize = 4
+)
+
+// NewDiskSet creates and returns an empty DiskSet with its run files in dir
+func NewDiskSet(dir string, memoryLimit int) *DiskSet {
+	if memoryLimit <= 0 {
+		memoryLimit = DefaultMemoryLimit
+	}
+	return &DiskSet{
+		dir:         dir,
+		memoryLimit: memoryLimit,
+		memory:      map[string]bool{},
+	}
+}
+
+func hashURL(url string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(url))
+	return h.Sum64()
+}
+
+// entryLess orders the urls of a run by hash, then by url
+func entryLess(h1 uint64, url1 string, h2 uint64, url2 string) bool {
+	if h1 != h2 {
+		return h1 < h2
+	}
+	return url1 < url2
+}
+
+// Add adds url to the set
+func (ds *DiskSet) Add(url string) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	found, err := ds.contains(url)
+	if err != nil || found {
+		return err
+	}
+	ds.memory[url] = true
+	ds.n++
+	if len(ds.memory) < ds.memoryLimit {
+		return nil
+	}
+	if err := ds.flush(); err != nil {
+		return err
+	}
+	return ds.compact()
+}
+
+// Contains reports whether url was added to the set
+func (ds *DiskSet) Contains(url string) (bool, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return ds.contains(url)
+}
+
+func (ds *DiskSet) contains(url string) (bool, error) {
+	if ds.memory[url] {
+		return true, nil
+	}
+	h := hashURL(url)
+	for i := len(ds.runs) - 1; i >= 0; i-- {
+		found, err := ds.runs[i].search(h, url)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+// search binary searches the run index for the first entry with hash h
+// and compares url with the urls of the entries having that hash
+func (r *run) search(h uint64, url string) (bool, error) {
+	lo, hi := int64(0), r.n
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		v, _, err := r.entry(mid)
+		if err != nil {
+			return false, err
+		}
+		if v < h {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	for ; lo < r.n; lo++ {
+		v, offset, err := r.entry(lo)
+		if err != nil || v != h {
+			return false, err
+		}
+		stored, err := r.url(offset)
+		if err != nil {
+			return false, err
+		}
+		if stored == url {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// entry returns the hash and the data offset of the i-th url of the run
+func (r *run) entry(i int64) (uint64, int64, error) {
+	var buf [indexEntrySize]byte
+	if _, err := r.index.ReadAt(buf[:], i*indexEntrySize); err != nil {
+		return 0, 0, fmt.Errorf("visited : %s", err)
+	}
+	return binary.BigEndian.Uint64(buf[:8]), int64(binary.BigEndian.Uint64(buf[8:])), nil
+}
+
+// url returns the url written at offset of the run data
+func (r *run) url(offset int64) (string, error) {
+	var buf [lengthSize]byte
+	if _, err := r.data.ReadAt(buf[:], offset); err != nil {
+		return "", fmt.Errorf("visited : %s", err)
+	}
+	url := make([]byte, binary.BigEndian.Uint32(buf[:]))
+	if _, err := r.data.ReadAt(url, offset+lengthSize); err != nil {
+		return "", fmt.Errorf("visited : %s", err)
+	}
+	return string(url), nil
+}
+
+// remove closes and deletes the files of the run
+func (r *run) remove() {
+	r.index.Close()
+	r.data.Close()
+	os.Remove(r.index.Name())
+	os.Remove(r.data.Name())
+}
+
+// flush writes the urls in memory as a new run of level 0
+func (ds *DiskSet) flush() error {
+	type entry struct {
+		hash uint64
+		url  string
+	}
+	entries := make([]entry, 0, len(ds.memory))
+	for url := range ds.memory {
+		entries = append(entries, entry{hashURL(url), url})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entryLess(entries[i].hash, entries[i].url, entries[j].hash, entries[j].url)
+	})
+
+	r, err := ds.writeRun(0, func(emit func(uint64, string) error) error {
+		for _, e := range entries {
+			if err := emit(e.hash, e.url); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	ds.runs = append(ds.runs, r)
+	ds.memory = map[string]bool{}
+	return nil
+}
+
+// compact merges the newest runs while mergeFactor of them have the same level
+func (ds *DiskSet) compact() error {
+	for len(ds.runs) >= mergeFactor {
+		last := len(ds.runs)
+		level := ds.runs[last-1].level
+		first := last - 1
+		for first > 0 && ds.runs[first-1].level == level {
+			first--
+		}
+		if last-first < mergeFactor {
+			return nil
+		}
+		merged, err := ds.merge(ds.runs[first:], level+1)
+		if err != nil {
+			return err
+		}
+		for _, r := range ds.runs[first:] {
+			r.remove()
+		}
+		ds.runs = append(ds.runs[:first], merged)
+	}
+	return nil
+}
+
+// runReader reads the urls of a run in order
+type runReader struct {
+	index *bufio.Reader
+	data  *bufio.Reader
+	left  int64
+	hash  uint64
+	url   string
+}
+
+func newRunReader(r *run) *runReader {
+	return &runReader{
+		index: bufio.NewReader(io.NewSectionReader(r.index, 0, r.n*indexEntrySize)),
+		data:  bufio.NewReader(io.NewSectionReader(r.data, 0, r.size)),
+		left:  r.n,
+	}
+}
+
+// next reads the next url of the run, ok is false once every url is read
+func (rr *runReader) next() (ok bool, err error) {
+	if rr.left == 0 {
+		return false, nil
+	}
+	var entry [indexEntrySize]byte
+	if _, err := io.ReadFull(rr.index, entry[:]); err != nil {
+		return false, fmt.Errorf("visited : %s", err)
+	}
+	var length [lengthSize]byte
+	if _, err := io.ReadFull(rr.data, length[:]); err != nil {
+		return false, fmt.Errorf("visited : %s", err)
+	}
+	url := make([]byte, binary.BigEndian.Uint32(length[:]))
+	if _, err := io.ReadFull(rr.data, url); err != nil {
+		return false, fmt.Errorf("visited : %s", err)
+	}
+	rr.hash, rr.url = binary.BigEndian.Uint64(entry[:8]), string(url)
+	rr.left--
+	return true, nil
+}
+
+// merge writes the urls of runs to a single run of level
+func (ds *DiskSet) merge(runs []*run, level int) (*run, error) {
+	// active holds the readers which still have a url to merge
+	var active []*runReader
+	for _, r := range runs {
+		rr := newRunReader(r)
+		ok, err := rr.next()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			active = append(active, rr)
+		}
+	}
+
+	return ds.writeRun(level, func(emit func(uint64, string) error) error {
+		for len(active) > 0 {
+			least := 0
+			for j, rr := range active {
+				if entryLess(rr.hash, rr.url, active[least].hash, active[least].url) {
+					least = j
+				}
+			}
+			rr := active[least]
+			if err := emit(rr.hash, rr.url); err != nil {
+				return err
+			}
+			ok, err := rr.next()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				active = append(active[:least], active[least+1:]...)
+			}
+		}
+		return nil
+	})
+}
+
+// writeRun writes the urls passed to emit, in increasing order, to a new run of level
+func (ds *DiskSet) writeRun(level int, write func(emit func(uint64, string) error) error) (*run, error) {
+	ds.seq++
+	name := filepath.Join(ds.dir, fmt.Sprintf("visited-%06d", ds.seq))
+	index, err := os.OpenFile(name+".idx", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("visited : %s", err)
+	}
+	data, err := os.OpenFile(name+".dat", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		index.Close()
+		os.Remove(index.Name())
+		return nil, fmt.Errorf("visited : %s", err)
+	}
+	r := &run{index: index, data: data, level: level}
+	iw, dw := bufio.NewWriter(index), bufio.NewWriter(data)
+	var entry [indexEntrySize]byte
+	var length [lengthSize]byte
+	err = write(func(h uint64, url string) error {
+		binary.BigEndian.PutUint64(entry[:8], h)
+		binary.BigEndian.PutUint64(entry[8:], uint64(r.size))
+		binary.BigEndian.PutUint32(length[:], uint32(len(url)))
+		if _, err := iw.Write(entry[:]); err != nil {
+			return fmt.Errorf("visited : %s", err)
+		}
+		if _, err := dw.Write(length[:]); err != nil {
+			return fmt.Errorf("visited : %s", err)
+		}
+		if _, err := dw.WriteString(url); err != nil {
+			return fmt.Errorf("visited : %s", err)
+		}
+		r.size += lengthSize + int64(len(url))
+		r.n++
+		return nil
+	})
+	if err == nil {
+		if err = iw.Flush(); err == nil {
+			err = dw.Flush()
+		}
+		if err != nil {
+			err = fmt.Errorf("visited : %s", err)
+		}
+	}
+	if err != nil {
+		r.remove()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Len returns the number of urls in the set
+func (ds *DiskSet) Len() int {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return ds.n
+}
+
+// Close closes the run files
+func (ds *DiskSet) Close() error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	var err error
+	for _, r := range ds.runs {
+		if cerr := r.index.Close(); err == nil {
+			err = cerr
+		}
+		if cerr := r.data.Close(); err == nil {
+			err = cerr
+		}
+	}
+	ds.runs = nil
+	ds.memory = map[string]bool{}
+	return err
+}
@@ -0,0 +1,89 @@
+package frontier_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers/frontier"
+)
+
+func TestVisitedSet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "visited-test-")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a disk set keeping 4 urls in memory writes a run every 4 urls
+	// and merges runs while the urls are added
+	sets := map[string]frontier.VisitedSet{
+		"memory": frontier.NewMemorySet(),
+		"disk":   frontier.NewDiskSet(dir, 4),
+	}
+
+	for name, set := range sets {
+		t.Run("it should report added urls with "+name+" storage", func(t *testing.T) {
+			defer set.Close()
+
+			for i := 0; i < 100; i += 2 {
+				if err := set.Add(fmt.Sprintf("https://example.com/%d.html", i)); err != nil {
+					t.Fatalf("expected no error, got %s", err)
+				}
+			}
+			// adding a url again does not change the set
+			set.Add("https://example.com/0.html")
+
+			if set.Len() != 50 {
+				t.Errorf("expected 50 urls, got %d", set.Len())
+			}
+
+			for i := 0; i < 100; i++ {
+				url := fmt.Sprintf("https://example.com/%d.html", i)
+				got, err := set.Contains(url)
+				if err != nil {
+					t.Fatalf("expected no error, got %s", err)
+				}
+				if expected := i%2 == 0; expected != got {
+					t.Errorf("%s : expected %t, got %t", url, expected, got)
+				}
+			}
+		})
+	}
+
+	t.Run("it should merge runs level by level", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "visited-test-")
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		// 1000 urls make 500 runs of 2 urls, merged 4 at a time
+		set := frontier.NewDiskSet(dir, 2)
+		defer set.Close()
+		for i := 0; i < 1000; i++ {
+			if err := set.Add(fmt.Sprintf("https://example.com/%d.html", i)); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+		}
+
+		for i := 0; i < 1100; i++ {
+			url := fmt.Sprintf("https://example.com/%d.html", i)
+			got, err := set.Contains(url)
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if expected := i < 1000; expected != got {
+				t.Errorf("%s : expected %t, got %t", url, expected, got)
+			}
+		}
+
+		// at most 3 runs are left at each of the 5 levels
+		runs, _ := filepath.Glob(filepath.Join(dir, "visited-*.idx"))
+		if len(runs) == 0 || len(runs) > 15 {
+			t.Errorf("expected at most 15 runs, got %d", len(runs))
+		}
+	})
+}
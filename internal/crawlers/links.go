@@ -0,0 +1,97 @@
+package crawlers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Link defines a link found in a html page
+// Element and Attribute name the html element and attribute the link came from
+// Text is the anchor text of the link, or the alt text of images
+// NoFollow is set by rel="nofollow" or by a nofollow directive of the page
+type Link struct {
+	URL       string
+	Element   string
+	Attribute string
+	Rel       string
+	Text      string
+	NoFollow  bool
+}
+
+// LinkAction defines what a crawler does with a link
+type LinkAction int
+
+const (
+	// Ignore drops the link
+	Ignore LinkAction = iota
+	// Record keeps the link in the sitemap without fetching it
+	Record
+	// Follow keeps the link in the sitemap and fetches it
+	Follow
+)
+
+// String returns the name of a LinkAction
+func (la LinkAction) String() string {
+	switch la {
+	case Record:
+		return "record"
+	case Follow:
+		return "follow"
+	default:
+		return "ignore"
+	}
+}
+
+// LinkPolicy maps html element names to the action taken for links found in them
+// links from elements missing in the policy are ignored
+type LinkPolicy map[string]LinkAction
+
+// FollowedElements are the elements whose links are followed by default
+var FollowedElements = []string{"a", "area", "iframe", "frame", "meta"}
+
+// RecordedElements are the elements whose links are recorded by default
+var RecordedElements = []string{"link", "img", "script", "source", "form"}
+
+// DefaultLinkPolicy returns the LinkPolicy used when none is configured
+// navigation links are followed, resources and form targets are only recorded
+func DefaultLinkPolicy() LinkPolicy {
+	policy, _ := NewLinkPolicy(FollowedElements, RecordedElements)
+	return policy
+}
+
+// NewLinkPolicy creates a LinkPolicy from the elements to follow and to record
+func NewLinkPolicy(follow, record []string) (LinkPolicy, error) {
+	policy := LinkPolicy{}
+	for _, element := range record {
+		element = strings.ToLower(strings.TrimSpace(element))
+		if element == "" {
+			continue
+		}
+		policy[element] = Record
+	}
+	for _, element := range follow {
+		element = strings.ToLower(strings.TrimSpace(element))
+		if element == "" {
+			continue
+		}
+		if policy[element] == Record {
+			return nil, fmt.Errorf("link policy : %s : cannot be both followed and recorded", element)
+		}
+		policy[element] = Follow
+	}
+	return policy, nil
+}
+
+// Action returns the action for a link
+func (lp LinkPolicy) Action(link Link) LinkAction {
+	return lp[link.Element]
+}
+
+// URLs returns the urls of links
+func URLs(links []Link) []string {
+	var urls []string
+	for _, link := range links {
+		urls = append(urls, link.URL)
+	}
+	return urls
+}
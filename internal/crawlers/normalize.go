@@ -0,0 +1,183 @@
+package crawlers
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// TrailingSlash defines how a Normalizer treats a trailing slash in url paths
+type TrailingSlash int
+
+const (
+	// KeepSlash leaves paths as they are
+	KeepSlash TrailingSlash = iota
+	// AddSlash adds a trailing slash to paths whose last segment has no file extension
+	AddSlash
+	// RemoveSlash removes the trailing slash of every path
+	RemoveSlash
+)
+
+// ParseTrailingSlash returns the TrailingSlash named keep, add or remove
+func ParseTrailingSlash(name string) (TrailingSlash, error) {
+	switch strings.ToLower(name) {
+	case "", "keep":
+		return KeepSlash, nil
+	case "add":
+		return AddSlash, nil
+	case "remove":
+		return RemoveSlash, nil
+	}
+	return KeepSlash, fmt.Errorf("trailing slash : %q : expected keep, add or remove", name)
+}
+
+// DefaultTrackingParams are query parameters which only track visitors
+var DefaultTrackingParams = []string{"utm_*", "gclid", "fbclid", "msclkid"}
+
+// Normalizer canonicalizes urls so that one page is recorded under one url
+// fragments are stripped, scheme and host are lowercased, default ports are
+// dropped and dot segments are resolved; the other steps are optional
+type Normalizer struct {
+	// SortQuery sorts query parameters by name
+	SortQuery bool
+	// TrailingSlash normalizes the trailing slash of paths
+	TrailingSlash TrailingSlash
+	// StripParams are query parameters to remove, a trailing * matches a prefix (eg: utm_*)
+	StripParams []string
+}
+
+// Normalize returns the canonical form of a url
+// urls which cannot be parsed are returned unchanged
+func (n *Normalizer) Normalize(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Opaque != "" {
+		return rawURL
+	}
+
+	u.Fragment = ""
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = dropDefaultPort(u.Scheme, strings.ToLower(u.Host))
+
+	p := removeDotSegments(u.EscapedPath())
+	p = n.trailingSlash(p)
+	if unescaped, err := url.PathUnescape(p); err == nil {
+		u.Path, u.RawPath = unescaped, p
+	}
+
+	u.RawQuery = n.query(u.RawQuery)
+	u.ForceQuery = false
+
+	return u.String()
+}
+
+// IsHTTP reports whether rawURL is an absolute http or https url
+// links with other schemes, eg: mailto: or javascript:, cannot be fetched
+func IsHTTP(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func dropDefaultPort(scheme, host string) string {
+	i := strings.LastIndex(host, ":")
+	// a colon inside brackets belongs to an ipv6 address
+	if i < 0 || i < strings.LastIndex(host, "]") {
+		return host
+	}
+	port := host[i+1:]
+	if port == "" || (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		return host[:i]
+	}
+	return host
+}
+
+// removeDotSegments resolves "." and ".." segments of a path (RFC 3986 5.2.4)
+func removeDotSegments(p string) string {
+	if !strings.Contains(p, ".") {
+		return p
+	}
+	segments := strings.Split(p, "/")
+	var out []string
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			// the leading empty segment of an absolute path is never removed
+			if len(out) > 1 || (len(out) == 1 && out[0] != "") {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, segment)
+		}
+	}
+	return strings.Join(out, "/")
+}
+
+func (n *Normalizer) trailingSlash(p string) string {
+	switch n.TrailingSlash {
+	case AddSlash:
+		if p == "" {
+			return "/"
+		}
+		last := p[strings.LastIndex(p, "/")+1:]
+		if last != "" && !strings.Contains(last, ".") {
+			return p + "/"
+		}
+	case RemoveSlash:
+		return strings.TrimRight(p, "/")
+	}
+	return p
+}
+
+// query strips tracking parameters and optionally sorts the rest
+// parameters keep their original encoding
+func (n *Normalizer) query(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" || n.strip(param) {
+			continue
+		}
+		params = append(params, param)
+	}
+	if n.SortQuery {
+		sort.SliceStable(params, func(i, j int) bool {
+			return paramName(params[i]) < paramName(params[j])
+		})
+	}
+	return strings.Join(params, "&")
+}
+
+func (n *Normalizer) strip(param string) bool {
+	name := paramName(param)
+	for _, pattern := range n.StripParams {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(name, pattern[:len(pattern)-1]) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func paramName(param string) string {
+	name := param
+	if i := strings.Index(param, "="); i >= 0 {
+		name = param[:i]
+	}
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
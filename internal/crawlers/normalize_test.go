@@ -0,0 +1,99 @@
+package crawlers_test
+
+import (
+	"testing"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+)
+
+func TestNormalizer(t *testing.T) {
+	t.Run("it should canonicalize urls", func(t *testing.T) {
+		normalizer := &crawlers.Normalizer{}
+
+		tests := map[string]string{
+			"https://example.com":                       "https://example.com",
+			"https://example.com/about#team":            "https://example.com/about",
+			"HTTP://Example.COM:80/about":               "http://example.com/about",
+			"https://example.com:443/about":             "https://example.com/about",
+			"https://example.com:8443/about":            "https://example.com:8443/about",
+			"https://example.com/a/./b/../c/page.html":  "https://example.com/a/c/page.html",
+			"https://example.com/../about":              "https://example.com/about",
+			"https://example.com/about?b=2&a=1":         "https://example.com/about?b=2&a=1",
+			"https://example.com/docs/a%20b.html#intro": "https://example.com/docs/a%20b.html",
+			"https://[::1]:443/about":                   "https://[::1]/about",
+			"mailto:info@example.com":                   "mailto:info@example.com",
+		}
+
+		for raw, expected := range tests {
+			got := normalizer.Normalize(raw)
+			if expected != got {
+				t.Errorf("%s : expected %s, got %s", raw, expected, got)
+			}
+		}
+	})
+
+	t.Run("it should sort query and strip tracking parameters", func(t *testing.T) {
+		normalizer := &crawlers.Normalizer{
+			SortQuery:   true,
+			StripParams: crawlers.DefaultTrackingParams,
+		}
+
+		tests := map[string]string{
+			"https://example.com/about?b=2&a=1":                       "https://example.com/about?a=1&b=2",
+			"https://example.com/about?utm_source=x&utm_medium=y":     "https://example.com/about",
+			"https://example.com/about?q=go&gclid=123&utm_campaign=z": "https://example.com/about?q=go",
+		}
+
+		for raw, expected := range tests {
+			got := normalizer.Normalize(raw)
+			if expected != got {
+				t.Errorf("%s : expected %s, got %s", raw, expected, got)
+			}
+		}
+	})
+
+	t.Run("it should normalize trailing slashes", func(t *testing.T) {
+		add := &crawlers.Normalizer{TrailingSlash: crawlers.AddSlash}
+		remove := &crawlers.Normalizer{TrailingSlash: crawlers.RemoveSlash}
+
+		tests := []struct {
+			normalizer *crawlers.Normalizer
+			raw        string
+			expected   string
+		}{
+			{add, "https://example.com", "https://example.com/"},
+			{add, "https://example.com/about", "https://example.com/about/"},
+			{add, "https://example.com/about/", "https://example.com/about/"},
+			{add, "https://example.com/about.html", "https://example.com/about.html"},
+			{remove, "https://example.com/", "https://example.com"},
+			{remove, "https://example.com/about/", "https://example.com/about"},
+			{remove, "https://example.com/about", "https://example.com/about"},
+		}
+
+		for _, test := range tests {
+			got := test.normalizer.Normalize(test.raw)
+			if test.expected != got {
+				t.Errorf("%s : expected %s, got %s", test.raw, test.expected, got)
+			}
+		}
+	})
+}
+
+func TestIsHTTP(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected bool
+	}{
+		{"https://example.com/about.html", true},
+		{"http://example.com", true},
+		{"mailto:info@example.com", false},
+		{"javascript:alert(document.cookie)", false},
+		{"/about.html", false},
+	}
+
+	for _, test := range tests {
+		if got := crawlers.IsHTTP(test.raw); test.expected != got {
+			t.Errorf("%s : expected %t, got %t", test.raw, test.expected, got)
+		}
+	}
+}
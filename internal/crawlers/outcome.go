@@ -0,0 +1,131 @@
+package crawlers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Outcome defines the result of the fetch of a url
+type Outcome string
+
+const (
+	// OutcomeOK is a html page fetched and parsed
+	OutcomeOK Outcome = "ok"
+	// OutcomeNotHTML is a page which is not html, its content type is kept
+	OutcomeNotHTML Outcome = "not-html"
+	// OutcomeHTTPError is a response with an error status code
+	OutcomeHTTPError Outcome = "http-error"
+	// OutcomeTimeout is a request which timed out
+	OutcomeTimeout Outcome = "timeout"
+	// OutcomeDNS is a host name which could not be resolved
+	OutcomeDNS Outcome = "dns"
+	// OutcomeRefused is a connection refused by the server
+	OutcomeRefused Outcome = "connection-refused"
+	// OutcomeTLS is a failed tls handshake or an invalid server certificate
+	OutcomeTLS Outcome = "tls"
+	// OutcomeTooLarge is a response body larger than the fetcher accepts
+	OutcomeTooLarge Outcome = "too-large"
+	// OutcomeRedirectLoop is a redirect loop
+	OutcomeRedirectLoop Outcome = "redirect-loop"
+	// OutcomeRobots is a url disallowed by robots.txt, it is never fetched
+	OutcomeRobots Outcome = "robots"
+	// OutcomeError is any other failure
+	OutcomeError Outcome = "error"
+)
+
+// Failed reports whether the outcome is a failed fetch
+// pages which are not html and urls disallowed by robots.txt are not failures
+func (o Outcome) Failed() bool {
+	switch o {
+	case OutcomeOK, OutcomeNotHTML, OutcomeRobots:
+		return false
+	default:
+		return true
+	}
+}
+
+// outcomes maps the errors of the taxonomy to the outcome of a fetch
+var outcomes = []struct {
+	err     error
+	outcome Outcome
+}{
+	{ErrPageNotHTML, OutcomeNotHTML},
+	{ErrDisallowedByRobots, OutcomeRobots},
+	{ErrTimeout, OutcomeTimeout},
+	{ErrDNS, OutcomeDNS},
+	{ErrConnectionRefused, OutcomeRefused},
+	{ErrTLS, OutcomeTLS},
+	{ErrBodyTooLarge, OutcomeTooLarge},
+	{ErrRedirectLoop, OutcomeRedirectLoop},
+}
+
+// Classify returns the outcome of a fetch which returned fetched and err
+// fetchers which do not return the errors of the taxonomy are classified
+// by the status code of fetched
+func Classify(fetched *FetchResult, err error) Outcome {
+	if err == nil {
+		return OutcomeOK
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return OutcomeHTTPError
+	}
+	for _, o := range outcomes {
+		if errors.Is(err, o.err) {
+			return o.outcome
+		}
+	}
+	if fetched != nil && fetched.StatusCode != 0 && fetched.StatusCode != 200 {
+		return OutcomeHTTPError
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return OutcomeTimeout
+	}
+	return OutcomeError
+}
+
+// Err returns the error of the taxonomy for the outcome, nil when there is none
+func (o Outcome) Err() error {
+	for _, known := range outcomes {
+		if known.outcome == o {
+			return known.err
+		}
+	}
+	return nil
+}
+
+// ErrorPolicy defines when a crawl is aborted because of failed pages
+// failed pages are always kept in the sitemap with their outcome
+type ErrorPolicy struct {
+	// MaxErrors is the number of failed pages which aborts the crawl
+	// 0 means the crawl continues whatever the number of failed pages
+	MaxErrors int
+}
+
+// ParseErrorPolicy returns the ErrorPolicy named by policy
+// continue, abort (on the first failed page) or abort-after:N
+func ParseErrorPolicy(policy string) (ErrorPolicy, error) {
+	switch {
+	case policy == "" || policy == "continue":
+		return ErrorPolicy{}, nil
+	case policy == "abort":
+		return ErrorPolicy{MaxErrors: 1}, nil
+	case strings.HasPrefix(policy, "abort-after:"):
+		n, err := strconv.Atoi(strings.TrimPrefix(policy, "abort-after:"))
+		if err != nil || n < 1 {
+			return ErrorPolicy{}, fmt.Errorf("error policy : %q : expected a number of errors greater than 0", policy)
+		}
+		return ErrorPolicy{MaxErrors: n}, nil
+	default:
+		return ErrorPolicy{}, fmt.Errorf("error policy : %q : expected one of continue, abort, abort-after:N", policy)
+	}
+}
+
+// Abort reports whether a crawl with failures failed pages is aborted
+func (ep ErrorPolicy) Abort(failures int) bool {
+	return ep.MaxErrors > 0 && failures >= ep.MaxErrors
+}
@@ -0,0 +1,84 @@
+package crawlers_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name     string
+		fetched  *crawlers.FetchResult
+		err      error
+		expected crawlers.Outcome
+	}{
+		{"ok", &crawlers.FetchResult{StatusCode: 200}, nil, crawlers.OutcomeOK},
+		{"not html", &crawlers.FetchResult{StatusCode: 200, ContentType: "image/png"}, crawlers.ErrPageNotHTML, crawlers.OutcomeNotHTML},
+		{"robots", nil, crawlers.ErrDisallowedByRobots, crawlers.OutcomeRobots},
+		{"http error", &crawlers.FetchResult{StatusCode: 404}, &crawlers.StatusError{URL: "https://example.com", StatusCode: 404}, crawlers.OutcomeHTTPError},
+		{"untyped http error", &crawlers.FetchResult{StatusCode: 404}, errors.New("status code: 404"), crawlers.OutcomeHTTPError},
+		{"wrapped error", nil, fmt.Errorf("fetch : %w", crawlers.ErrRedirectLoop), crawlers.OutcomeRedirectLoop},
+		{"dns", nil, &crawlers.FetchError{URL: "https://example.invalid", Kind: crawlers.ErrDNS, Err: errors.New("no such host")}, crawlers.OutcomeDNS},
+		{"other", nil, errors.New("unsupported protocol scheme"), crawlers.OutcomeError},
+	}
+
+	for _, test := range tests {
+		t.Run("it should classify "+test.name, func(t *testing.T) {
+			if got := crawlers.Classify(test.fetched, test.err); got != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestFetchError(t *testing.T) {
+	t.Run("it should match its kind and the error it wraps", func(t *testing.T) {
+		cause := errors.New("x509: certificate signed by unknown authority")
+		err := fmt.Errorf("crawl : %w", &crawlers.FetchError{URL: "https://example.com", Kind: crawlers.ErrTLS, Err: cause})
+
+		if !errors.Is(err, crawlers.ErrTLS) || !errors.Is(err, cause) {
+			t.Errorf("expected %v to match %s and its cause", err, crawlers.ErrTLS)
+		}
+		if errors.Is(err, crawlers.ErrTimeout) {
+			t.Errorf("expected %v not to match %s", err, crawlers.ErrTimeout)
+		}
+		var fetchErr *crawlers.FetchError
+		if !errors.As(err, &fetchErr) || fetchErr.URL != "https://example.com" {
+			t.Errorf("expected fetch error of https://example.com, got %v", err)
+		}
+	})
+}
+
+func TestErrorPolicy(t *testing.T) {
+	t.Run("it should parse error policies", func(t *testing.T) {
+		policies := map[string]int{"": 0, "continue": 0, "abort": 1, "abort-after:5": 5}
+		for name, maxErrors := range policies {
+			policy, err := crawlers.ParseErrorPolicy(name)
+			if err != nil {
+				t.Errorf("%q : expected no error, got %s", name, err)
+			}
+			if policy.MaxErrors != maxErrors {
+				t.Errorf("%q : expected %d, got %d", name, maxErrors, policy.MaxErrors)
+			}
+		}
+
+		for _, name := range []string{"ignore", "abort-after:0", "abort-after:x"} {
+			if _, err := crawlers.ParseErrorPolicy(name); err == nil {
+				t.Errorf("%q : expected error, got nil", name)
+			}
+		}
+	})
+
+	t.Run("it should abort once the maximum errors are reached", func(t *testing.T) {
+		policy := crawlers.ErrorPolicy{MaxErrors: 3}
+		if policy.Abort(2) || !policy.Abort(3) {
+			t.Errorf("expected abort at 3 failures")
+		}
+		if (crawlers.ErrorPolicy{}).Abort(100) {
+			t.Errorf("expected continue policy never to abort")
+		}
+	})
+}
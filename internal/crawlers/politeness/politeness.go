@@ -0,0 +1,250 @@
+package politeness
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+	"github.com/spf13/viper"
+)
+
+// Config defines how requests are spread over time and hosts
+// zero values mean no limit
+type Config struct {
+	// HostDelay is the minimum time between two requests to a host
+	HostDelay time.Duration
+	// HostRate is the maximum number of requests per second to a host
+	HostRate float64
+	// HostConcurrency is the maximum number of concurrent requests to a host
+	HostConcurrency int
+	// GlobalRate is the maximum number of requests per second to all hosts
+	GlobalRate float64
+	// GlobalConcurrency is the maximum number of concurrent requests to all hosts
+	GlobalConcurrency int
+}
+
+// Limiter spaces out and caps the requests made to each host
+// the Crawl-delay asked for by robots.txt is applied when it is longer
+// than the configured delay
+type Limiter struct {
+	config Config
+	robots crawlers.RobotsChecker
+	// mu guards hosts and the next request time of every slot
+	mu     sync.Mutex
+	hosts  map[string]*slot
+	global *slot
+}
+
+// slot holds the request schedule of a host or of all hosts
+type slot struct {
+	delay time.Duration
+	// conns holds a token for every request in flight, nil when not capped
+	conns chan struct{}
+	next  time.Time
+}
+
+func newSlot(delay time.Duration, concurrency int) *slot {
+	s := &slot{delay: delay}
+	if concurrency > 0 {
+		s.conns = make(chan struct{}, concurrency)
+	}
+	return s
+}
+
+// acquire waits for a free connection of the slot
+func (s *slot) acquire(ctx context.Context) error {
+	if s.conns == nil {
+		return nil
+	}
+	select {
+	case s.conns <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *slot) release() {
+	if s.conns != nil {
+		<-s.conns
+	}
+}
+
+// NewLimiter creates and returns a Limiter
+// robots may be nil, Crawl-delay is then ignored
+func NewLimiter(config Config, robots crawlers.RobotsChecker) *Limiter {
+	return &Limiter{
+		config: config,
+		robots: robots,
+		hosts:  map[string]*slot{},
+		global: newSlot(rateDelay(config.GlobalRate), config.GlobalConcurrency),
+	}
+}
+
+// NewConfiguredLimiter creates and returns a Limiter from the HOST_DELAY,
+// HOST_RATE, HOST_CONCURRENCY, GLOBAL_RATE and GLOBAL_CONCURRENCY configuration
+func NewConfiguredLimiter(robots crawlers.RobotsChecker) *Limiter {
+	return NewLimiter(Config{
+		HostDelay:         viper.GetDuration("HOST_DELAY"),
+		HostRate:          viper.GetFloat64("HOST_RATE"),
+		HostConcurrency:   viper.GetInt("HOST_CONCURRENCY"),
+		GlobalRate:        viper.GetFloat64("GLOBAL_RATE"),
+		GlobalConcurrency: viper.GetInt("GLOBAL_CONCURRENCY"),
+	}, robots)
+}
+
+// rateDelay returns the time between requests made at rate requests per second
+func rateDelay(rate float64) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / rate)
+}
+
+// Acquire waits until a request to rawURL is allowed
+// release must be called once the request is complete
+// an error is returned, and nothing is to be released, when ctx is cancelled
+func (l *Limiter) Acquire(ctx context.Context, rawURL string) (release func(), err error) {
+	host, err := l.host(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	// a connection to the host is taken, and the host delay waited for, first
+	// so that requests waiting for a busy or slow host do not hold global
+	// connections other hosts could use
+	if err := host.acquire(ctx); err != nil {
+		return nil, err
+	}
+	if err := sleep(ctx, l.reserve(host)); err != nil {
+		host.release()
+		return nil, err
+	}
+	if err := l.global.acquire(ctx); err != nil {
+		host.release()
+		return nil, err
+	}
+	release = func() {
+		l.global.release()
+		host.release()
+	}
+
+	if err := sleep(ctx, l.reserveGlobal(host)); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// Backoff postpones every request to the host of rawURL by at least wait
+// and waits for the turn of the retry, it implements crawlers.Throttle
+// it is called by a fetcher retrying a request, so the connection
+// acquired for the request is kept
+func (l *Limiter) Backoff(ctx context.Context, rawURL string, wait time.Duration) error {
+	host, err := l.host(ctx, rawURL)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	if until := time.Now().Add(wait); until.After(host.next) {
+		host.next = until
+	}
+	l.mu.Unlock()
+	if err := sleep(ctx, l.reserve(host)); err != nil {
+		return err
+	}
+	return sleep(ctx, l.reserveGlobal(host))
+}
+
+// sleep waits for wait, it returns ctx.Err() when ctx is cancelled first
+func sleep(ctx context.Context, wait time.Duration) error {
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve schedules the next request to host and returns the time to wait for it
+func (l *Limiter) reserve(host *slot) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	start := now
+	if host.next.After(start) {
+		start = host.next
+	}
+	host.next = start.Add(host.delay)
+	return start.Sub(now)
+}
+
+// reserveGlobal schedules the next request to all hosts and returns the time to wait for it
+// the request to host is postponed, so the next request to host is postponed as well
+func (l *Limiter) reserveGlobal(host *slot) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	start := now
+	if l.global.next.After(start) {
+		start = l.global.next
+	}
+	if l.global.delay > 0 {
+		l.global.next = start.Add(l.global.delay)
+	}
+	if next := start.Add(host.delay); next.After(host.next) {
+		host.next = next
+	}
+	return start.Sub(now)
+}
+
+// host returns the slot of the host of rawURL
+// ctx.Err() is returned when ctx is cancelled while robots.txt is fetched
+func (l *Limiter) host(ctx context.Context, rawURL string) (*slot, error) {
+	name := hostName(rawURL)
+	l.mu.Lock()
+	s, ok := l.hosts[name]
+	l.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+
+	// robots.txt may have to be fetched, so the lock is not held
+	delay := l.config.HostDelay
+	if d := rateDelay(l.config.HostRate); d > delay {
+		delay = d
+	}
+	if l.robots != nil {
+		if d := l.robots.CrawlDelay(ctx, rawURL); d > delay {
+			delay = d
+		}
+		// the Crawl-delay is unknown, the slot is created by a later request
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if s, ok := l.hosts[name]; ok {
+		return s, nil
+	}
+	s = newSlot(delay, l.config.HostConcurrency)
+	l.hosts[name] = s
+	return s, nil
+}
+
+func hostName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
@@ -0,0 +1,214 @@
+package politeness_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers/politeness"
+)
+
+type stubRobotsChecker struct {
+	delays map[string]time.Duration
+}
+
+func (src *stubRobotsChecker) Allowed(ctx context.Context, url string) bool {
+	return true
+}
+
+func (src *stubRobotsChecker) CrawlDelay(ctx context.Context, url string) time.Duration {
+	return src.delays[url]
+}
+
+// requestTimes acquires the limiter for every url in turn and returns the time of each request
+func requestTimes(t *testing.T, limiter *politeness.Limiter, urls ...string) []time.Duration {
+	start := time.Now()
+	var times []time.Duration
+	for _, url := range urls {
+		release, err := limiter.Acquire(context.Background(), url)
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		times = append(times, time.Since(start))
+		release()
+	}
+	return times
+}
+
+func TestLimiter(t *testing.T) {
+	t.Run("it should space out requests to the same host", func(t *testing.T) {
+		limiter := politeness.NewLimiter(politeness.Config{HostRate: 20}, nil)
+
+		times := requestTimes(t, limiter,
+			"https://example.com/1.html",
+			"https://example.com/2.html",
+			"https://docs.example.org",
+			"https://example.com/3.html",
+		)
+
+		if times[1] < 40*time.Millisecond {
+			t.Errorf("expected second request after 50ms, got %s", times[1])
+		}
+		if times[2]-times[1] > 20*time.Millisecond {
+			t.Errorf("expected request to another host right away, got %s", times[2]-times[1])
+		}
+		if times[3] < 90*time.Millisecond {
+			t.Errorf("expected third request after 100ms, got %s", times[3])
+		}
+	})
+
+	t.Run("it should use the robots.txt crawl delay when it is longer", func(t *testing.T) {
+		robots := &stubRobotsChecker{delays: map[string]time.Duration{
+			"https://example.com/1.html": 50 * time.Millisecond,
+		}}
+		limiter := politeness.NewLimiter(politeness.Config{HostDelay: time.Millisecond}, robots)
+
+		times := requestTimes(t, limiter, "https://example.com/1.html", "https://example.com/2.html")
+
+		if times[1] < 40*time.Millisecond {
+			t.Errorf("expected second request after 50ms, got %s", times[1])
+		}
+	})
+
+	t.Run("it should apply the global rate to all hosts", func(t *testing.T) {
+		limiter := politeness.NewLimiter(politeness.Config{GlobalRate: 20}, nil)
+
+		times := requestTimes(t, limiter, "https://example.com", "https://docs.example.org")
+
+		if times[1] < 40*time.Millisecond {
+			t.Errorf("expected second request after 50ms, got %s", times[1])
+		}
+	})
+
+	t.Run("it should not hold back other hosts behind a waiting request", func(t *testing.T) {
+		limiter := politeness.NewLimiter(politeness.Config{HostDelay: 200 * time.Millisecond}, nil)
+
+		release, err := limiter.Acquire(context.Background(), "https://example.com/1.html")
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		release()
+		// the second request to the host waits for 200ms
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go limiter.Acquire(ctx, "https://example.com/2.html")
+		time.Sleep(10 * time.Millisecond)
+
+		times := requestTimes(t, limiter, "https://docs.example.org")
+
+		if times[0] > 20*time.Millisecond {
+			t.Errorf("expected request to another host right away, got %s", times[0])
+		}
+	})
+
+	t.Run("it should not hold a global connection while waiting for a host", func(t *testing.T) {
+		limiter := politeness.NewLimiter(politeness.Config{HostDelay: 200 * time.Millisecond, GlobalConcurrency: 1}, nil)
+
+		release, err := limiter.Acquire(context.Background(), "https://example.com/1.html")
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		release()
+		// the second request to the host waits for 200ms
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			if release, err := limiter.Acquire(ctx, "https://example.com/2.html"); err == nil {
+				release()
+			}
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		times := requestTimes(t, limiter, "https://docs.example.org")
+
+		if times[0] > 20*time.Millisecond {
+			t.Errorf("expected request to another host right away, got %s", times[0])
+		}
+	})
+
+	t.Run("it should cap concurrent requests to a host", func(t *testing.T) {
+		limiter := politeness.NewLimiter(politeness.Config{HostConcurrency: 2}, nil)
+
+		var mu sync.Mutex
+		inFlight, maxInFlight := 0, 0
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				release, err := limiter.Acquire(context.Background(), "https://example.com")
+				if err != nil {
+					t.Errorf("expected no error, got %s", err)
+					return
+				}
+				mu.Lock()
+				inFlight++
+				if inFlight > maxInFlight {
+					maxInFlight = inFlight
+				}
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+				release()
+			}()
+		}
+
+		// another host is not held up by the busy host
+		release, err := limiter.Acquire(context.Background(), "https://docs.example.org")
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		release()
+
+		wg.Wait()
+		if maxInFlight != 2 {
+			t.Errorf("expected 2 concurrent requests, got %d", maxInFlight)
+		}
+	})
+
+	t.Run("it should stop waiting when cancelled", func(t *testing.T) {
+		limiter := politeness.NewLimiter(politeness.Config{HostDelay: time.Hour, HostConcurrency: 1}, nil)
+
+		release, err := limiter.Acquire(context.Background(), "https://example.com")
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := limiter.Acquire(ctx, "https://example.com"); err != context.DeadlineExceeded {
+			t.Errorf("expected %s, got %v", context.DeadlineExceeded, err)
+		}
+	})
+
+	t.Run("it should postpone every request to a host which asked to back off", func(t *testing.T) {
+		limiter := politeness.NewLimiter(politeness.Config{}, nil)
+
+		start := time.Now()
+		if err := limiter.Backoff(context.Background(), "https://example.com/1.html", 50*time.Millisecond); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+			t.Errorf("expected retry after 50ms, got %s", elapsed)
+		}
+
+		// a retry abandoned by its worker still postpones the other workers
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := limiter.Backoff(ctx, "https://example.com/1.html", 50*time.Millisecond); err != context.Canceled {
+			t.Errorf("expected %s, got %v", context.Canceled, err)
+		}
+		times := requestTimes(t, limiter, "https://docs.example.org", "https://example.com/2.html")
+
+		if times[0] > 20*time.Millisecond {
+			t.Errorf("expected request to another host right away, got %s", times[0])
+		}
+		if times[1] < 40*time.Millisecond {
+			t.Errorf("expected request to the host after 50ms, got %s", times[1])
+		}
+	})
+}
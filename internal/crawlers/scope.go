@@ -0,0 +1,157 @@
+package crawlers
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// ScopeMode defines which hosts belong to a crawl
+type ScopeMode int
+
+const (
+	// SameHost keeps the host of the root url, with or without www.
+	SameHost ScopeMode = iota
+	// SameDomain keeps the registrable domain of the root url and all its subdomains
+	SameDomain
+)
+
+// ParseScopeMode returns the ScopeMode named host or domain
+func ParseScopeMode(name string) (ScopeMode, error) {
+	switch strings.ToLower(name) {
+	case "", "host":
+		return SameHost, nil
+	case "domain":
+		return SameDomain, nil
+	}
+	return SameHost, fmt.Errorf("scope : %q : expected host or domain", name)
+}
+
+// Scope defines which urls are crawled
+// http and https urls of the same host are in the same scope
+type Scope struct {
+	Mode ScopeMode
+	// AllowHosts are hosts in scope besides the ones selected by Mode
+	// a pattern "*.example.com" matches example.com and all its subdomains
+	AllowHosts []string
+	// DenyHosts are hosts never in scope, they take precedence over everything else
+	DenyHosts []string
+	// IncludePaths limits the scope to paths matching one of the patterns
+	IncludePaths []*regexp.Regexp
+	// ExcludePaths removes paths matching one of the patterns from the scope
+	ExcludePaths []*regexp.Regexp
+}
+
+// ParsePathPattern compiles a path pattern
+// a pattern starting with "re:" is a regular expression, otherwise it is a glob
+// where * matches any sequence of characters and ? matches a single character
+func ParsePathPattern(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, "re:") {
+		return regexp.Compile(pattern[3:])
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// ParsePathPatterns compiles a list of path patterns
+func ParsePathPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := ParsePathPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("scope : path pattern : %s", err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// Contains reports whether link is in scope of a crawl started from rootURL
+func (s *Scope) Contains(link, rootURL string) bool {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+	root, err := url.Parse(rootURL)
+	if err != nil {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if matchHosts(s.DenyHosts, host) {
+		return false
+	}
+	if !s.containsHost(host, strings.ToLower(root.Hostname())) && !matchHosts(s.AllowHosts, host) {
+		return false
+	}
+
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	if len(s.IncludePaths) > 0 && !matchPaths(s.IncludePaths, p) {
+		return false
+	}
+	return !matchPaths(s.ExcludePaths, p)
+}
+
+func (s *Scope) containsHost(host, rootHost string) bool {
+	switch s.Mode {
+	case SameDomain:
+		return registrableDomain(host) == registrableDomain(rootHost)
+	default:
+		return strings.TrimPrefix(host, "www.") == strings.TrimPrefix(rootHost, "www.")
+	}
+}
+
+// registrableDomain returns the public suffix plus one label of a host (eg: example.co.uk)
+// ip addresses and hosts without a known public suffix are returned as they are
+func registrableDomain(host string) string {
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+func matchHosts(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if strings.HasPrefix(pattern, "*.") {
+			if host == pattern[2:] || strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPaths(patterns []*regexp.Regexp, p string) bool {
+	for _, re := range patterns {
+		if re.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package crawlers_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+)
+
+func TestScope(t *testing.T) {
+	root := "https://example.com"
+
+	t.Run("it should keep the root host with or without www", func(t *testing.T) {
+		scope := &crawlers.Scope{Mode: crawlers.SameHost}
+
+		tests := map[string]bool{
+			"https://example.com/about.html":     true,
+			"http://example.com/about.html":      true,
+			"https://www.example.com/about.html": true,
+			"https://EXAMPLE.com:8443/about":     true,
+			"https://blog.example.com/":          false,
+			"https://example.com.evil.net/":      false,
+			"https://evilexample.com/":           false,
+			"ftp://example.com/file.txt":         false,
+			"mailto:info@example.com":            false,
+		}
+
+		for link, expected := range tests {
+			got := scope.Contains(link, root)
+			if expected != got {
+				t.Errorf("%s : expected %t, got %t", link, expected, got)
+			}
+		}
+	})
+
+	t.Run("it should keep the registrable domain and its subdomains", func(t *testing.T) {
+		scope := &crawlers.Scope{Mode: crawlers.SameDomain}
+
+		tests := map[string]bool{
+			"https://blog.example.com/":     true,
+			"https://a.b.example.com/":      true,
+			"https://example.com.evil.net/": false,
+			"https://example.org/":          false,
+		}
+
+		for link, expected := range tests {
+			got := scope.Contains(link, root)
+			if expected != got {
+				t.Errorf("%s : expected %t, got %t", link, expected, got)
+			}
+		}
+
+		if scope.Contains("https://other.co.uk/", "https://example.co.uk") {
+			t.Error("expected sites sharing a public suffix to be out of scope")
+		}
+	})
+
+	t.Run("it should apply host allow and deny lists", func(t *testing.T) {
+		scope := &crawlers.Scope{
+			Mode:       crawlers.SameDomain,
+			AllowHosts: []string{"docs.example.org"},
+			DenyHosts:  []string{"*.internal.example.com"},
+		}
+
+		tests := map[string]bool{
+			"https://docs.example.org/":          true,
+			"https://example.org/":               false,
+			"https://blog.example.com/":          true,
+			"https://internal.example.com/":      false,
+			"https://build.internal.example.com": false,
+		}
+
+		for link, expected := range tests {
+			got := scope.Contains(link, root)
+			if expected != got {
+				t.Errorf("%s : expected %t, got %t", link, expected, got)
+			}
+		}
+	})
+
+	t.Run("it should apply path include and exclude patterns", func(t *testing.T) {
+		include, err := crawlers.ParsePathPatterns([]string{"/docs/*", "/"})
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		scope := &crawlers.Scope{
+			IncludePaths: include,
+			ExcludePaths: []*regexp.Regexp{regexp.MustCompile(`/v[0-9]+/`)},
+		}
+
+		tests := map[string]bool{
+			"https://example.com":                 true,
+			"https://example.com/docs/intro.html": true,
+			"https://example.com/docs/v1/old":     false,
+			"https://example.com/blog/post.html":  false,
+		}
+
+		for link, expected := range tests {
+			got := scope.Contains(link, root)
+			if expected != got {
+				t.Errorf("%s : expected %t, got %t", link, expected, got)
+			}
+		}
+	})
+
+	t.Run("it should compile globs and regular expressions", func(t *testing.T) {
+		glob, _ := crawlers.ParsePathPattern("/docs/*.html")
+		if !glob.MatchString("/docs/a/b.html") || glob.MatchString("/docs/a.pdf") {
+			t.Errorf("unexpected glob matches for %s", glob)
+		}
+
+		re, _ := crawlers.ParsePathPattern("re:^/tag/")
+		if !re.MatchString("/tag/go") || re.MatchString("/blog/tag/go") {
+			t.Errorf("unexpected regex matches for %s", re)
+		}
+
+		if _, err := crawlers.ParsePathPattern("re:("); err == nil {
+			t.Error("expected error for invalid regex, got nil")
+		}
+	})
+}
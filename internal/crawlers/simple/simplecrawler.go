@@ -1,10 +1,13 @@
 package simple
 
 import (
+	"context"
 	"fmt"
-	"strings"
 
 	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers/checkpoint"
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers/frontier"
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers/politeness"
 	"github.com/nikhil-thomas/web-crawler/internal/sitemap"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -12,68 +15,196 @@ import (
 
 // CrawlManager implements sitemap.Crawler interface
 type CrawlManager struct {
-	fetcher crawlers.URLFetcher
+	fetcher crawlers.PageFetcher
+	opts    crawlers.Options
 }
 
 // NewCrawlManager creates and returns a CrawlManager
-func NewCrawlManager(fetcher crawlers.URLFetcher) *CrawlManager {
-	return &CrawlManager{fetcher: fetcher}
+func NewCrawlManager(fetcher crawlers.URLFetcher, opts ...crawlers.Option) *CrawlManager {
+	return &CrawlManager{
+		fetcher: crawlers.AdaptURLFetcher(fetcher),
+		opts:    crawlers.NewOptions(opts...),
+	}
 }
 
-func filterDomains(links []string, rootDomain string) []string {
-	var filteredLinks []string
-	for _, link := range links {
-		if strings.HasPrefix(link, rootDomain) {
-			filteredLinks = append(filteredLinks, link)
-		} else {
-			log.Info("skip  : ", link)
-		}
-	}
-	return filteredLinks
+// Crawl crawls webpages starting from one or more root urls and cretes sitemap
+// root urls share the visited urls and the scope of the crawl
+// cancelling ctx stops the crawl and returns the sitemap crawled so far with ctx.Err()
+// a crawl saved to a state file is continued when RESUME is set
+// with disk storage the returned result holds only the root urls, pages are passed to the page handler
+func (cm *CrawlManager) Crawl(ctx context.Context, rootURLs ...string) (*sitemap.Result, error) {
+	progress, err := cm.crawl(ctx, rootURLs...)
+	cm.opts.Finished(progress.Pages, progress.Failures, err)
+	return progress.Result, err
 }
 
-// Crawl crawls a webpage and cretes sitemap
-func (cm *CrawlManager) Crawl(rootURL string) (map[string]sitemap.Children, error) {
-	stmp := map[string]sitemap.Children{}
-	i := 0
-	urls := []string{rootURL}
+func (cm *CrawlManager) crawl(ctx context.Context, rootURLs ...string) (*checkpoint.Progress, error) {
+	store, err := frontier.OpenConfigured()
+	if err != nil {
+		return checkpoint.NewProgress(nil), fmt.Errorf("crawl manager: %w", err)
+	}
+	defer store.Close()
+	progress, err := checkpoint.Start(cm.opts.Seeds(rootURLs), store, cm.opts.OnPage)
+	if err != nil {
+		return checkpoint.NewProgress(nil), fmt.Errorf("crawl manager: %w", err)
+	}
+	seeds := progress.Result.Roots
+	urls, visited, queued := store.Frontier, store.Visited, store.Queued
+	// links out of scope are reported only once
+	outOfScope, err := store.NewSet("out-of-scope")
+	if err != nil {
+		return progress, fmt.Errorf("crawl manager: %w", err)
+	}
+	// pages are fetched one at a time, so only the delays between requests apply
+	limiter := politeness.NewConfiguredLimiter(cm.opts.Robots)
+
+	// progress is saved when the crawl stops for any reason
+	checkpointer := checkpoint.NewConfiguredCheckpointer()
+	defer checkpointer.Save(progress)
+
 	linksPerPage := viper.GetInt("LINKS_PER_PAGE")
 	pageLimit := viper.GetInt("PAGE_LIMIT")
+	maxDepth := viper.GetInt("MAX_DEPTH")
+	// new urls are not added once maxURLs urls are seen
+	maxURLs := viper.GetInt("MAX_URLS")
+	// the url limit is reported only once
+	urlLimitReached := false
 
-	for len(urls) > 0 {
-		url := urls[0]
-		links, err := cm.fetcher.ExtractURLs(url)
+	// a resumed crawl may have reached the page limit already
+	for pageLimit == 0 || progress.Processed < pageLimit {
+		select {
+		case <-ctx.Done():
+			log.Info("crawl  : cancelled : ", ctx.Err())
+			return progress, ctx.Err()
+		default:
+		}
+		entry, ok, err := urls.Pop()
 		if err != nil {
+			return progress, fmt.Errorf("crawl manager: %w", err)
+		}
+		if !ok {
+			break
+		}
+		// number of clicks from nearest root url, root urls are at depth 0
+		url, depth := entry.URL, entry.Depth
+		allowed := cm.opts.Allowed(ctx, url)
+		if ctx.Err() != nil {
+			log.Info("crawl  : cancelled : ", ctx.Err())
+			return progress, ctx.Err()
+		}
+		// urls disallowed by robots.txt are kept in sitemap without crawling
+		if !allowed {
+			progress.AddPage(url, depth, nil, crawlers.ErrDisallowedByRobots, nil)
+			cm.opts.Skip(url, crawlers.ErrDisallowedByRobots)
+			continue
+		}
+		fetched, err := cm.fetch(ctx, limiter, url)
+		// a fetch abandoned because of cancellation is not recorded
+		if ctx.Err() != nil {
+			log.Info("crawl  : cancelled : ", ctx.Err())
+			return progress, ctx.Err()
+		}
+		var links []crawlers.Link
+		if err == nil {
+			links = cm.opts.NormalizeLinks(fetched.Links)
+		}
+		progress.AddPage(url, depth, fetched, err, cm.opts.Linked(links))
+		cm.opts.Fetched(url, depth, fetched, err)
+		failed := crawlers.Classify(fetched, err).Failed()
+		if err != nil {
+			log.Error("crawl : ", err, url)
+		}
+
+		children, skipped := cm.opts.FilterScope(links, seeds)
+		for _, link := range skipped {
+			reported, err := outOfScope.Contains(link.URL)
+			if err == nil && !reported {
+				err = outOfScope.Add(link.URL)
+				cm.opts.OutOfScope(link.URL)
+			}
 			if err != nil {
-				if err != crawlers.ErrPageNotHTML {
-					return nil, fmt.Errorf("crawl manager: %s", err)
-				}
-				log.Error("crawl : ", err, url)
+				return progress, fmt.Errorf("crawl manager: %w", err)
 			}
 		}
 
-		children := filterDomains(links, rootURL)
+		// links of pages at max depth are not expanded
+		// if maxDepth param is 0, then there is no limit
+		if maxDepth > 0 && depth >= maxDepth && len(children) > 0 {
+			log.Info("depth  : max depth (", maxDepth, ") reached : ", url)
+			children = nil
+		}
 
 		k := 0
 		for _, link := range children {
-			if _, ok := stmp[link]; !ok {
-				stmp[url] = append(stmp[url], link)
-				log.Info("add    : ", link)
-				stmp[link] = sitemap.Children{}
-				urls = append(urls, link)
-				k++
+			action := cm.opts.Action(link)
+			if action == crawlers.Ignore {
+				continue
+			}
+			seen, err := visited.Contains(link.URL)
+			if err != nil {
+				return progress, fmt.Errorf("crawl manager: %w", err)
+			}
+			// a recorded link is crawled once it is found in a followable element
+			upgrade := false
+			if seen && action == crawlers.Follow {
+				isQueued, err := queued.Contains(link.URL)
+				if err != nil {
+					return progress, fmt.Errorf("crawl manager: %w", err)
+				}
+				upgrade = !isQueued
+			}
+			if !seen && maxURLs > 0 && visited.Len() >= maxURLs {
+				if !urlLimitReached {
+					log.Warn("crawl  : url limit (", maxURLs, ") reached : new urls are not added")
+					urlLimitReached = true
+				}
+				continue
+			}
+			if !seen || upgrade {
+				if !seen {
+					if err := visited.Add(link.URL); err != nil {
+						return progress, fmt.Errorf("crawl manager: %w", err)
+					}
+					// recorded links are kept in sitemap without crawling
+					progress.AddChild(link.URL, action == crawlers.Follow)
+					log.Info("add    : ", link.URL)
+					cm.opts.Discovered(url, depth+1, link, action)
+					k++
+				} else {
+					progress.Queue(link.URL)
+				}
+				if action == crawlers.Follow {
+					if err := queued.Add(link.URL); err != nil {
+						return progress, fmt.Errorf("crawl manager: %w", err)
+					}
+					if err := urls.Push(frontier.Entry{URL: link.URL, Depth: depth + 1}); err != nil {
+						return progress, fmt.Errorf("crawl manager: %w", err)
+					}
+				}
 			}
 			if linksPerPage > 0 && k >= linksPerPage {
 				break
 			}
 		}
 
-		urls = urls[1:]
-		i++
-		log.Info("links : ", i, " : queue : ", len(urls))
-		if pageLimit != 0 && i >= pageLimit {
-			break
+		log.Info("links : ", progress.Processed, " : queue : ", urls.Len())
+		checkpointer.Tick(progress)
+
+		// failed pages of a resumed crawl count towards the error policy
+		if failed && cm.opts.OnError.Abort(progress.Failures) {
+			log.Error("crawl  : ", progress.Failures, " failed pages : stop crawiling")
+			return progress, fmt.Errorf("crawl manager: %w : %v", crawlers.ErrTooManyErrors, err)
 		}
 	}
-	return stmp, nil
+	return progress, nil
+}
+
+// fetch fetches a page once the limiter allows a request to its host
+func (cm *CrawlManager) fetch(ctx context.Context, limiter *politeness.Limiter, url string) (*crawlers.FetchResult, error) {
+	release, err := limiter.Acquire(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return cm.fetcher.Fetch(crawlers.WithThrottle(ctx, limiter), url)
 }
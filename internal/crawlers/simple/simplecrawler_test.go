@@ -1,11 +1,24 @@
 package simple_test
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
 	"github.com/nikhil-thomas/web-crawler/internal/crawlers/simple"
+	"github.com/spf13/viper"
 )
 
 type stubURLFetcher struct {
@@ -19,6 +32,89 @@ func (suf *stubURLFetcher) ExtractURLs(url string) ([]string, error) {
 	return links, nil
 }
 
+type stubPageFetcher struct {
+	stubURLFetcher
+}
+
+func (spf *stubPageFetcher) Fetch(ctx context.Context, url string) (*crawlers.FetchResult, error) {
+	result := &crawlers.FetchResult{
+		URL:         url,
+		FinalURL:    url,
+		StatusCode:  200,
+		ContentType: "text/html",
+	}
+	for _, link := range spf.urls[url] {
+		element := "a"
+		if strings.HasSuffix(link, ".png") {
+			element = "img"
+		}
+		noFollow := strings.HasSuffix(link, "#nofollow")
+		link = strings.TrimSuffix(link, "#nofollow")
+		result.Links = append(result.Links, crawlers.Link{URL: link, Element: element, NoFollow: noFollow})
+	}
+	return result, nil
+}
+
+// cancellingPageFetcher cancels the crawl when cancelAt is fetched
+type cancellingPageFetcher struct {
+	stubPageFetcher
+	cancelAt string
+	cancel   context.CancelFunc
+}
+
+func (cpf *cancellingPageFetcher) Fetch(ctx context.Context, url string) (*crawlers.FetchResult, error) {
+	if url == cpf.cancelAt {
+		cpf.cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return cpf.stubPageFetcher.Fetch(ctx, url)
+}
+
+// countingPageFetcher counts the fetches of every url
+type countingPageFetcher struct {
+	stubPageFetcher
+	mu      sync.Mutex
+	fetched map[string]int
+}
+
+func (cpf *countingPageFetcher) Fetch(ctx context.Context, url string) (*crawlers.FetchResult, error) {
+	cpf.mu.Lock()
+	cpf.fetched[url]++
+	cpf.mu.Unlock()
+	return cpf.stubPageFetcher.Fetch(ctx, url)
+}
+
+// failingPageFetcher fails the fetch of some urls
+type failingPageFetcher struct {
+	stubPageFetcher
+	failures map[string]error
+}
+
+func (fpf *failingPageFetcher) Fetch(ctx context.Context, url string) (*crawlers.FetchResult, error) {
+	err, ok := fpf.failures[url]
+	if !ok {
+		return fpf.stubPageFetcher.Fetch(ctx, url)
+	}
+	if _, transport := err.(*crawlers.FetchError); transport {
+		return nil, err
+	}
+	return &crawlers.FetchResult{URL: url, FinalURL: url, StatusCode: 503}, err
+}
+
+type stubRobotsChecker struct {
+	disallow string
+}
+
+func (src *stubRobotsChecker) Allowed(ctx context.Context, url string) bool {
+	return !strings.HasPrefix(url, src.disallow)
+}
+
+func (src *stubRobotsChecker) CrawlDelay(ctx context.Context, url string) time.Duration {
+	return 0
+}
+
 func TestCrawlManager(t *testing.T) {
 	urlFetcher := &stubURLFetcher{
 		urls: map[string][]string{
@@ -46,13 +142,444 @@ func TestCrawlManager(t *testing.T) {
 	})
 	t.Run("it should generate a sitemap from urls", func(t *testing.T) {
 		crwl := simple.NewCrawlManager(urlFetcher)
-		stmp, err := crwl.Crawl("https://example.com")
+		result, err := crwl.Crawl(context.Background(), "https://example.com")
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+
+		gotBytes, _ := json.Marshal(result.Sitemap)
+		got := string(gotBytes)
+
+		expected := `{"https://example.com":["https://example.com/about.html","https://example.com/contact.html"],"https://example.com/about.html":["https://example.com/about/rev1.html","https://example.com/about/rev2.html"],"https://example.com/about/rev1.html":[],"https://example.com/about/rev2.html":[],"https://example.com/contact.html":["https://example.com/contact/rev1.html","https://example.com/contact/rev2.html"],"https://example.com/contact/rev1.html":[],"https://example.com/contact/rev2.html":[]}`
+
+		if expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+
+	})
+
+	t.Run("it should keep urls disallowed by robots.txt without crawling them", func(t *testing.T) {
+		skipped := map[string]error{}
+		crwl := simple.NewCrawlManager(
+			urlFetcher,
+			crawlers.WithRobots(&stubRobotsChecker{disallow: "https://example.com/contact"}),
+			crawlers.WithSkipHandler(func(url string, reason error) {
+				skipped[url] = reason
+			}),
+		)
+		result, err := crwl.Crawl(context.Background(), "https://example.com")
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+
+		gotBytes, _ := json.Marshal(result.Sitemap)
+		got := string(gotBytes)
+
+		expected := `{"https://example.com":["https://example.com/about.html","https://example.com/contact.html"],"https://example.com/about.html":["https://example.com/about/rev1.html","https://example.com/about/rev2.html"],"https://example.com/about/rev1.html":[],"https://example.com/about/rev2.html":[],"https://example.com/contact.html":[]}`
+
+		if expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+
+		if page := result.Pages["https://example.com/contact.html"]; page == nil || page.Outcome != crawlers.OutcomeRobots {
+			t.Errorf("expected https://example.com/contact.html outcome %s, got %+v", crawlers.OutcomeRobots, page)
+		}
+
+		if len(skipped) != 1 || skipped["https://example.com/contact.html"] != crawlers.ErrDisallowedByRobots {
+			t.Errorf("expected https://example.com/contact.html to be skipped, got %v", skipped)
+		}
+	})
+
+	t.Run("it should keep root urls disallowed by robots.txt without crawling them", func(t *testing.T) {
+		skipped := map[string]error{}
+		crwl := simple.NewCrawlManager(
+			urlFetcher,
+			crawlers.WithRobots(&stubRobotsChecker{disallow: "https://example.com/contact"}),
+			crawlers.WithSkipHandler(func(url string, reason error) {
+				skipped[url] = reason
+			}),
+		)
+		result, err := crwl.Crawl(context.Background(), "https://example.com/contact.html")
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+		if page := result.Pages["https://example.com/contact.html"]; page == nil || page.Outcome != crawlers.OutcomeRobots {
+			t.Errorf("expected https://example.com/contact.html outcome %s, got %+v", crawlers.OutcomeRobots, page)
+		}
+		if len(skipped) != 1 || skipped["https://example.com/contact.html"] != crawlers.ErrDisallowedByRobots {
+			t.Errorf("expected https://example.com/contact.html to be skipped, got %v", skipped)
+		}
+	})
+
+	t.Run("it should keep fetch results of crawled pages", func(t *testing.T) {
+		crwl := simple.NewCrawlManager(&stubPageFetcher{*urlFetcher})
+		result, err := crwl.Crawl(context.Background(), "https://example.com")
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+
+		expected := 7
+		got := len(result.Pages)
+		if expected != got {
+			t.Errorf("expected %d, got %d", expected, got)
+		}
+
+		for url, page := range result.Pages {
+			if page.URL != url || page.StatusCode != 200 || page.ContentType != "text/html" {
+				t.Errorf("expected fetch result of %s, got %+v", url, page)
+			}
+		}
+	})
+
+	t.Run("it should record links without following them", func(t *testing.T) {
+		pageFetcher := &stubPageFetcher{stubURLFetcher{
+			urls: map[string][]string{
+				"https://example.com": []string{
+					"https://example.com/about.html",
+					"https://example.com/logo.png",
+				},
+				"https://example.com/about.html": []string{
+					"https://example.com/about/rev1.html",
+				},
+				"https://example.com/logo.png": []string{
+					"https://example.com/never-fetched.html",
+				},
+			},
+		}}
+		crwl := simple.NewCrawlManager(pageFetcher)
+		result, err := crwl.Crawl(context.Background(), "https://example.com")
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+
+		gotBytes, _ := json.Marshal(result.Sitemap)
+		got := string(gotBytes)
+
+		expected := `{"https://example.com":["https://example.com/about.html","https://example.com/logo.png"],"https://example.com/about.html":["https://example.com/about/rev1.html"],"https://example.com/about/rev1.html":[],"https://example.com/logo.png":[]}`
+
+		if expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+
+		if _, ok := result.Pages["https://example.com/logo.png"]; ok {
+			t.Error("expected recorded link not to be fetched")
+		}
+	})
+
+	t.Run("it should not follow nofollow links", func(t *testing.T) {
+		pageFetcher := &stubPageFetcher{stubURLFetcher{
+			urls: map[string][]string{
+				"https://example.com": []string{
+					"https://example.com/login.html#nofollow",
+					"https://example.com/terms.html#nofollow",
+					"https://example.com/about.html",
+				},
+				"https://example.com/about.html": []string{
+					"https://example.com/terms.html",
+				},
+				"https://example.com/login.html": []string{
+					"https://example.com/never-fetched.html",
+				},
+			},
+		}}
+		crwl := simple.NewCrawlManager(pageFetcher)
+		result, err := crwl.Crawl(context.Background(), "https://example.com")
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+
+		gotBytes, _ := json.Marshal(result.Sitemap)
+		got := string(gotBytes)
+
+		expected := `{"https://example.com":["https://example.com/login.html","https://example.com/terms.html","https://example.com/about.html"],"https://example.com/about.html":[],"https://example.com/login.html":[],"https://example.com/terms.html":[]}`
+
+		if expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+
+		if _, ok := result.Pages["https://example.com/login.html"]; ok {
+			t.Error("expected nofollow link not to be fetched")
+		}
+		if _, ok := result.Pages["https://example.com/terms.html"]; !ok {
+			t.Error("expected nofollow link to be fetched once it is found in a followable link")
+		}
+	})
+
+	t.Run("it should deduplicate canonical urls", func(t *testing.T) {
+		urlFetcher := &stubURLFetcher{
+			urls: map[string][]string{
+				"https://example.com": []string{
+					"https://example.com/about/",
+					"https://example.com/about#team",
+					"HTTPS://Example.com:443/about",
+					"https://example.com/contact?utm_source=home",
+				},
+			},
+		}
+		crwl := simple.NewCrawlManager(
+			urlFetcher,
+			crawlers.WithNormalizer(&crawlers.Normalizer{
+				TrailingSlash: crawlers.RemoveSlash,
+				StripParams:   crawlers.DefaultTrackingParams,
+			}),
+		)
+		result, err := crwl.Crawl(context.Background(), "https://example.com/#top")
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+
+		gotBytes, _ := json.Marshal(result.Sitemap)
+		got := string(gotBytes)
+
+		expected := `{"https://example.com":["https://example.com/about","https://example.com/contact"],"https://example.com/about":[],"https://example.com/contact":[]}`
+
+		if expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	})
+
+	t.Run("it should only crawl links in scope", func(t *testing.T) {
+		urlFetcher := &stubURLFetcher{
+			urls: map[string][]string{
+				"https://example.com": []string{
+					"https://example.com.evil.net/about.html",
+					"http://www.example.com/about.html",
+					"https://blog.example.com/",
+				},
+			},
+		}
+		crwl := simple.NewCrawlManager(urlFetcher)
+		result, err := crwl.Crawl(context.Background(), "https://example.com")
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+
+		gotBytes, _ := json.Marshal(result.Sitemap)
+		got := string(gotBytes)
+
+		expected := `{"http://www.example.com/about.html":[],"https://example.com":["http://www.example.com/about.html"]}`
+
+		if expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	})
+
+	t.Run("it should stop expanding links beyond max depth", func(t *testing.T) {
+		viper.Set("MAX_DEPTH", 1)
+		defer viper.Set("MAX_DEPTH", 0)
+
+		crwl := simple.NewCrawlManager(urlFetcher)
+		result, err := crwl.Crawl(context.Background(), "https://example.com")
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+
+		gotBytes, _ := json.Marshal(result.Sitemap)
+		got := string(gotBytes)
+
+		expected := `{"https://example.com":["https://example.com/about.html","https://example.com/contact.html"],"https://example.com/about.html":[],"https://example.com/contact.html":[]}`
+
+		if expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+
+		depths := map[string]int{
+			"https://example.com":              0,
+			"https://example.com/about.html":   1,
+			"https://example.com/contact.html": 1,
+		}
+		for url, expected := range depths {
+			page, ok := result.Pages[url]
+			if !ok || page.Depth != expected {
+				t.Errorf("%s : expected depth %d, got %+v", url, expected, page)
+			}
+		}
+	})
+
+	t.Run("it should stop adding urls at the url limit", func(t *testing.T) {
+		viper.Set("MAX_URLS", 5)
+		defer viper.Set("MAX_URLS", 0)
+
+		crwl := simple.NewCrawlManager(urlFetcher)
+		result, err := crwl.Crawl(context.Background(), "https://example.com")
 
 		if err != nil {
 			t.Errorf("expected no error, got %s", err)
 		}
 
-		gotBytes, _ := json.Marshal(stmp)
+		// the children of the first of about.html and contact.html crawled fill the sitemap
+		if len(result.Sitemap) != 5 {
+			t.Errorf("expected 5 urls in sitemap, got %d", len(result.Sitemap))
+		}
+		if len(result.Pages) != 5 {
+			t.Errorf("expected every url in sitemap to be crawled, got %d pages", len(result.Pages))
+		}
+		if n := len(result.Sitemap["https://example.com"]); n != 2 {
+			t.Errorf("expected root to keep its 2 children, got %d", n)
+		}
+	})
+
+	t.Run("it should crawl from several root urls", func(t *testing.T) {
+		urlFetcher := &stubURLFetcher{
+			urls: map[string][]string{
+				"https://example.com/about.html": []string{
+					"https://example.com/about/rev1.html",
+					"https://example.com/about/rev2.html",
+					"https://docs.example.org",
+				},
+				"https://docs.example.org": []string{
+					"https://docs.example.org/intro.html",
+					"https://example.com/about.html",
+				},
+			},
+		}
+		crwl := simple.NewCrawlManager(urlFetcher)
+		result, err := crwl.Crawl(
+			context.Background(),
+			"https://example.com/about.html",
+			"https://docs.example.org",
+			"https://example.com/about.html#team",
+		)
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+
+		gotBytes, _ := json.Marshal(result.Roots)
+		got := string(gotBytes)
+
+		expected := `["https://example.com/about.html","https://docs.example.org"]`
+
+		if expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+
+		gotBytes, _ = json.Marshal(result.Sitemap)
+		got = string(gotBytes)
+
+		expected = `{"https://docs.example.org":["https://docs.example.org/intro.html"],"https://docs.example.org/intro.html":[],"https://example.com/about.html":["https://example.com/about/rev1.html","https://example.com/about/rev2.html"],"https://example.com/about/rev1.html":[],"https://example.com/about/rev2.html":[]}`
+
+		if expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	})
+
+	t.Run("it should return the partial sitemap when cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		pageFetcher := &cancellingPageFetcher{
+			stubPageFetcher: stubPageFetcher{*urlFetcher},
+			cancelAt:        "https://example.com/about.html",
+			cancel:          cancel,
+		}
+		crwl := simple.NewCrawlManager(pageFetcher)
+		result, err := crwl.Crawl(ctx, "https://example.com")
+
+		if err != context.Canceled {
+			t.Errorf("expected %s, got %v", context.Canceled, err)
+		}
+		if result == nil {
+			t.Fatal("expected partial sitemap, got nil")
+		}
+		if _, ok := result.Pages["https://example.com"]; !ok {
+			t.Error("expected root page to be kept")
+		}
+		gotBytes, _ := json.Marshal(result.Sitemap["https://example.com"])
+		got := string(gotBytes)
+
+		expected := `["https://example.com/about.html","https://example.com/contact.html"]`
+
+		if expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+		if _, ok := result.Sitemap["https://example.com/about/rev1.html"]; ok {
+			t.Error("expected links of the cancelled page to be missing")
+		}
+	})
+
+	t.Run("it should pass pages to the page handler without keeping them with disk storage", func(t *testing.T) {
+		viper.Set("STORAGE", "disk")
+		viper.Set("STORAGE_MEMORY_LIMIT", 2)
+		defer viper.Set("STORAGE", "")
+		defer viper.Set("STORAGE_MEMORY_LIMIT", 0)
+
+		pages := map[string]int{}
+		crwl := simple.NewCrawlManager(urlFetcher, crawlers.WithPageHandler(func(url string, depth int, fetched *crawlers.FetchResult, err error) {
+			pages[url] = depth
+		}))
+		result, err := crwl.Crawl(context.Background(), "https://example.com")
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+
+		expected := map[string]int{
+			"https://example.com":                   0,
+			"https://example.com/about.html":        1,
+			"https://example.com/contact.html":      1,
+			"https://example.com/about/rev1.html":   2,
+			"https://example.com/about/rev2.html":   2,
+			"https://example.com/contact/rev1.html": 2,
+			"https://example.com/contact/rev2.html": 2,
+		}
+		if !reflect.DeepEqual(expected, pages) {
+			t.Errorf("expected %v, got %v", expected, pages)
+		}
+		if len(result.Pages) != 0 || len(result.Sitemap["https://example.com"]) != 0 {
+			t.Errorf("expected no sitemap in memory, got %v", result.Sitemap)
+		}
+	})
+
+	t.Run("it should resume a crawl without refetching completed pages", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "resume-test-")
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		defer os.RemoveAll(dir)
+		state := filepath.Join(dir, "crawl.state")
+
+		pageFetcher := &countingPageFetcher{
+			stubPageFetcher: stubPageFetcher{*urlFetcher},
+			fetched:         map[string]int{},
+		}
+
+		// the first crawl stops after 2 pages and saves its progress
+		viper.Set("PAGE_LIMIT", 2)
+		viper.Set("CHECKPOINT", state)
+		_, err = simple.NewCrawlManager(pageFetcher).Crawl(context.Background(), "https://example.com")
+		viper.Set("PAGE_LIMIT", 0)
+		viper.Set("CHECKPOINT", "")
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+
+		viper.Set("RESUME", state)
+		defer viper.Set("RESUME", "")
+		result, err := simple.NewCrawlManager(pageFetcher).Crawl(context.Background())
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+		for url, n := range pageFetcher.fetched {
+			if n > 1 {
+				t.Errorf("expected %s to be fetched once, got %d fetches", url, n)
+			}
+		}
+		if len(pageFetcher.fetched) != 7 {
+			t.Errorf("expected 7 pages fetched, got %d", len(pageFetcher.fetched))
+		}
+
+		gotBytes, _ := json.Marshal(result.Sitemap)
 		got := string(gotBytes)
 
 		expected := `{"https://example.com":["https://example.com/about.html","https://example.com/contact.html"],"https://example.com/about.html":["https://example.com/about/rev1.html","https://example.com/about/rev2.html"],"https://example.com/about/rev1.html":[],"https://example.com/about/rev2.html":[],"https://example.com/contact.html":["https://example.com/contact/rev1.html","https://example.com/contact/rev2.html"],"https://example.com/contact/rev1.html":[],"https://example.com/contact/rev2.html":[]}`
@@ -60,6 +587,184 @@ func TestCrawlManager(t *testing.T) {
 		if expected != got {
 			t.Errorf("expected %s, got %s", expected, got)
 		}
+	})
+
+	t.Run("it should keep failed pages with their outcome", func(t *testing.T) {
+		pageFetcher := &failingPageFetcher{
+			stubPageFetcher: stubPageFetcher{*urlFetcher},
+			failures: map[string]error{
+				"https://example.com/about.html": errors.New("status code: 503"),
+				"https://example.com/contact.html": &crawlers.FetchError{
+					URL:  "https://example.com/contact.html",
+					Kind: crawlers.ErrTimeout,
+					Err:  errors.New("i/o timeout"),
+				},
+			},
+		}
+		crwl := simple.NewCrawlManager(pageFetcher)
+		result, err := crwl.Crawl(context.Background(), "https://example.com")
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
 
+		gotBytes, _ := json.Marshal(result.Sitemap)
+		got := string(gotBytes)
+
+		expected := `{"https://example.com":["https://example.com/about.html","https://example.com/contact.html"],"https://example.com/about.html":[],"https://example.com/contact.html":[]}`
+
+		if expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+
+		if page := result.Pages["https://example.com/about.html"]; page == nil || page.Outcome != crawlers.OutcomeHTTPError || page.StatusCode != 503 {
+			t.Errorf("expected about.html outcome %s with status 503, got %+v", crawlers.OutcomeHTTPError, page)
+		}
+		if page := result.Pages["https://example.com/contact.html"]; page == nil || page.Outcome != crawlers.OutcomeTimeout {
+			t.Errorf("expected contact.html outcome %s, got %+v", crawlers.OutcomeTimeout, page)
+		}
+		if page := result.Pages["https://example.com"]; page == nil || page.Outcome != crawlers.OutcomeOK {
+			t.Errorf("expected root outcome %s, got %+v", crawlers.OutcomeOK, page)
+		}
+	})
+
+	t.Run("it should abort the crawl as the error policy says", func(t *testing.T) {
+		pageFetcher := &failingPageFetcher{
+			stubPageFetcher: stubPageFetcher{*urlFetcher},
+			failures: map[string]error{
+				"https://example.com/about.html": errors.New("status code: 503"),
+			},
+		}
+		crwl := simple.NewCrawlManager(pageFetcher, crawlers.WithErrorPolicy(crawlers.ErrorPolicy{MaxErrors: 1}))
+		result, err := crwl.Crawl(context.Background(), "https://example.com")
+
+		if !errors.Is(err, crawlers.ErrTooManyErrors) {
+			t.Errorf("expected %s, got %v", crawlers.ErrTooManyErrors, err)
+		}
+		if result == nil || result.Pages["https://example.com/about.html"] == nil {
+			t.Errorf("expected partial sitemap with the failed page, got %+v", result)
+		}
+	})
+
+	t.Run("it should keep every link in the link graph", func(t *testing.T) {
+		urlFetcher := &stubURLFetcher{
+			urls: map[string][]string{
+				"https://example.com": []string{
+					"https://example.com/about.html",
+					"https://example.com/contact.html",
+				},
+				"https://example.com/about.html": []string{
+					"https://example.com/contact.html",
+					"https://example.com",
+				},
+			},
+		}
+		crwl := simple.NewCrawlManager(&stubPageFetcher{*urlFetcher})
+		result, err := crwl.Crawl(context.Background(), "https://example.com")
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+
+		gotBytes, _ := json.Marshal(result.Sitemap)
+		got := string(gotBytes)
+
+		expected := `{"https://example.com":["https://example.com/about.html","https://example.com/contact.html"],"https://example.com/about.html":[],"https://example.com/contact.html":[]}`
+
+		if expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+
+		if len(result.Graph.Edges) != 4 {
+			t.Errorf("expected 4 links, got %v", result.Graph.Edges)
+		}
+		if n := result.Graph.Inbound("https://example.com/contact.html"); n != 2 {
+			t.Errorf("expected 2 pages linking to contact.html, got %d", n)
+		}
+		referrers := result.Graph.Referrers("https://example.com")
+		if len(referrers) != 1 || referrers[0].Source != "https://example.com/about.html" || referrers[0].Element != "a" {
+			t.Errorf("expected root to be linked from about.html, got %v", referrers)
+		}
+	})
+
+	t.Run("it should stream crawl events", func(t *testing.T) {
+		pageFetcher := &failingPageFetcher{
+			stubPageFetcher: stubPageFetcher{stubURLFetcher{
+				urls: map[string][]string{
+					"https://example.com": []string{
+						"https://example.com/about.html",
+						"https://example.com/contact.html",
+						"https://other.com",
+					},
+					"https://example.com/about.html": []string{
+						"https://example.com/about/rev1.html",
+						"https://example.com/about/rev2.html",
+						"https://other.com",
+					},
+				},
+			}},
+			failures: map[string]error{
+				"https://example.com/about/rev1.html": errors.New("status code: 503"),
+			},
+		}
+		var buf bytes.Buffer
+		events := crawlers.NewEventWriter(&buf)
+		crwl := simple.NewCrawlManager(
+			pageFetcher,
+			crawlers.WithRobots(&stubRobotsChecker{disallow: "https://example.com/contact"}),
+			crawlers.WithEventHandler(events.Handle),
+		)
+		_, err := crwl.Crawl(context.Background(), "https://example.com")
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+		if err := events.Err(); err != nil {
+			t.Errorf("expected no error writing events, got %s", err)
+		}
+
+		var got []crawlers.Event
+		scanner := bufio.NewScanner(&buf)
+		for scanner.Scan() {
+			var event crawlers.Event
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				t.Fatalf("expected one json event per line, got %q : %s", scanner.Text(), err)
+			}
+			got = append(got, event)
+		}
+
+		counts := map[crawlers.EventType]int{}
+		for _, event := range got {
+			counts[event.Type]++
+		}
+		expected := map[crawlers.EventType]int{
+			crawlers.EventPageFetched:    3,
+			crawlers.EventError:          1,
+			crawlers.EventLinkDiscovered: 4,
+			crawlers.EventLinkSkipped:    2,
+			crawlers.EventCrawlFinished:  1,
+		}
+		gotBytes, _ := json.Marshal(counts)
+		expectedBytes, _ := json.Marshal(expected)
+		if string(gotBytes) != string(expectedBytes) {
+			t.Errorf("expected events %s, got %s", expectedBytes, gotBytes)
+		}
+
+		last := got[len(got)-1]
+		if last.Type != crawlers.EventCrawlFinished || last.Pages == nil || *last.Pages != 5 || last.Failures == nil || *last.Failures != 1 {
+			t.Errorf("expected crawl_finished with 5 pages and 1 failure last, got %+v", last)
+		}
+		for _, event := range got {
+			switch {
+			case event.Time.IsZero():
+				t.Errorf("expected event time, got %+v", event)
+			case event.Type == crawlers.EventError && (event.URL != "https://example.com/about/rev1.html" || event.StatusCode != 503):
+				t.Errorf("expected error event for about/rev1.html with status 503, got %+v", event)
+			case event.Type == crawlers.EventLinkDiscovered && event.URL == "https://example.com/about/rev2.html" && (event.Source != "https://example.com/about.html" || event.Depth == nil || *event.Depth != 2 || event.Action != "follow"):
+				t.Errorf("expected about/rev2.html discovered in about.html at depth 2, got %+v", event)
+			case event.Type == crawlers.EventLinkSkipped && event.URL == "https://example.com/contact.html" && event.Reason != crawlers.ErrDisallowedByRobots.Error():
+				t.Errorf("expected contact.html skipped by robots.txt, got %+v", event)
+			}
+		}
 	})
 }
@@ -0,0 +1,227 @@
+package linkcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers/politeness"
+	"github.com/nikhil-thomas/web-crawler/internal/sitemap"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Link defines the status of a url linked from the crawled pages
+// Checked is set for urls which were checked without being crawled
+// Referrers are the links to the url
+type Link struct {
+	URL        string
+	StatusCode int
+	Outcome    crawlers.Outcome
+	Err        error
+	Checked    bool
+	Referrers  []sitemap.Edge
+}
+
+// Skipped reports whether the link was not checked because robots.txt disallows it
+func (l *Link) Skipped() bool {
+	return l.Outcome == crawlers.OutcomeRobots
+}
+
+// Broken reports whether the link is broken
+// error status codes and failed requests are broken links, urls disallowed
+// by robots.txt and pages too large to be crawled are not
+func (l *Link) Broken() bool {
+	switch l.Outcome {
+	case crawlers.OutcomeHTTPError:
+		return l.StatusCode >= 400
+	case crawlers.OutcomeTooLarge:
+		return false
+	default:
+		return l.Outcome.Failed()
+	}
+}
+
+// Report defines the status of every link found in the crawled pages
+type Report struct {
+	Links []*Link
+}
+
+// Broken returns the broken links sorted by url
+func (r *Report) Broken() []*Link {
+	var broken []*Link
+	for _, link := range r.Links {
+		if link.Broken() {
+			broken = append(broken, link)
+		}
+	}
+	sort.Slice(broken, func(i, j int) bool {
+		return broken[i].URL < broken[j].URL
+	})
+	return broken
+}
+
+// Skipped returns the links disallowed by robots.txt sorted by url
+func (r *Report) Skipped() []*Link {
+	var skipped []*Link
+	for _, link := range r.Links {
+		if link.Skipped() {
+			skipped = append(skipped, link)
+		}
+	}
+	sort.Slice(skipped, func(i, j int) bool {
+		return skipped[i].URL < skipped[j].URL
+	})
+	return skipped
+}
+
+// Fprint writes the broken links and the pages linking to them to io.Writer
+// followed by the links which were skipped
+func (r *Report) Fprint(w io.Writer) {
+	broken := r.Broken()
+	fmt.Fprintf(w, "\n::::: Broken Links: %d of %d ::::\n", len(broken), len(r.Links))
+	for _, link := range broken {
+		if link.Outcome == crawlers.OutcomeHTTPError {
+			fmt.Fprintf(w, "%s : %d\n", link.URL, link.StatusCode)
+		} else {
+			fmt.Fprintf(w, "%s : %s : %v\n", link.URL, link.Outcome, link.Err)
+		}
+		for _, edge := range link.Referrers {
+			fmt.Fprintf(w, "  %s : %q (%s)\n", edge.Source, edge.Text, edge.Element)
+		}
+	}
+	skipped := r.Skipped()
+	if len(skipped) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n::::: Skipped Links: %d ::::\n", len(skipped))
+	for _, link := range skipped {
+		fmt.Fprintf(w, "%s : %v\n", link.URL, link.Err)
+	}
+}
+
+// Checker checks the status of every link found in the crawled pages
+// urls which were crawled keep the status of their fetch, the others
+// are checked with a LinkChecker without being crawled
+// urls in scope of the crawl are only checked when robots.txt allows it
+type Checker struct {
+	checker crawlers.LinkChecker
+	opts    crawlers.Options
+	limiter *politeness.Limiter
+	workers int
+}
+
+// NewChecker creates and returns a Checker
+// opts are the options of the crawl, its scope and robots.txt rules apply to the checks
+// requests are limited like the requests of a crawl, with WORKER_COUNT requests at a time
+func NewChecker(checker crawlers.LinkChecker, opts ...crawlers.Option) *Checker {
+	workers := viper.GetInt("WORKER_COUNT")
+	if workers == 0 {
+		workers = 10
+	}
+	options := crawlers.NewOptions(opts...)
+	return &Checker{
+		checker: checker,
+		opts:    options,
+		limiter: politeness.NewConfiguredLimiter(options.Robots),
+		workers: workers,
+	}
+}
+
+// Check returns the status of every http link in graph
+// pages holds the crawled urls, the other links are checked
+// links in scope of a crawl started from rootURLs are skipped when robots.txt disallows them
+// cancelling ctx stops checking, links not checked yet are left out of the report
+// and the report is returned with ctx.Err()
+func (c *Checker) Check(ctx context.Context, rootURLs []string, pages map[string]*sitemap.Page, graph *sitemap.Graph) (*Report, error) {
+	report := &Report{}
+	var unchecked []*Link
+	seen := map[string]bool{}
+	for _, edge := range graph.Edges {
+		if seen[edge.Target] || !crawlers.IsHTTP(edge.Target) {
+			continue
+		}
+		seen[edge.Target] = true
+		link := &Link{URL: edge.Target, Referrers: graph.Referrers(edge.Target)}
+		if page, ok := pages[edge.Target]; ok {
+			link.StatusCode, link.Outcome, link.Err = page.StatusCode, page.Outcome, page.Err
+			report.Links = append(report.Links, link)
+			continue
+		}
+		unchecked = append(unchecked, link)
+	}
+
+	links := make(chan *Link)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for link := range links {
+				if !c.check(ctx, link, rootURLs) {
+					continue
+				}
+				mu.Lock()
+				report.Links = append(report.Links, link)
+				mu.Unlock()
+			}
+		}()
+	}
+forLoop:
+	for _, link := range unchecked {
+		select {
+		case links <- link:
+		case <-ctx.Done():
+			break forLoop
+		}
+	}
+	close(links)
+	wg.Wait()
+	return report, ctx.Err()
+}
+
+// disallowed reports whether url is in scope of the crawl and disallowed by robots.txt
+// urls out of scope are not crawled, so robots.txt is not consulted for them
+func (c *Checker) disallowed(ctx context.Context, url string, rootURLs []string) bool {
+	return c.opts.InScope(url, rootURLs) && !c.opts.Allowed(ctx, url)
+}
+
+// check sets the status of link once the limiter allows a request to its host
+// it reports false when the check was abandoned because ctx was cancelled
+func (c *Checker) check(ctx context.Context, link *Link, rootURLs []string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if c.disallowed(ctx, link.URL, rootURLs) {
+		if ctx.Err() != nil {
+			return false
+		}
+		log.Info("skip   : ", crawlers.ErrDisallowedByRobots, " : ", link.URL)
+		link.Outcome, link.Err = crawlers.OutcomeRobots, crawlers.ErrDisallowedByRobots
+		return true
+	}
+	release, err := c.limiter.Acquire(ctx, link.URL)
+	if err != nil {
+		return false
+	}
+	defer release()
+	log.Debug("check  : ", link.URL)
+	fetched, err := c.checker.Check(crawlers.WithThrottle(ctx, c.limiter), link.URL)
+	if ctx.Err() != nil {
+		return false
+	}
+	link.Checked = true
+	link.Err = err
+	link.Outcome = crawlers.Classify(fetched, err)
+	if fetched != nil {
+		link.StatusCode = fetched.StatusCode
+	}
+	if link.Broken() {
+		log.Warn("broken : ", link.URL, " : ", err)
+	}
+	return true
+}
@@ -0,0 +1,213 @@
+package linkcheck_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+	"github.com/nikhil-thomas/web-crawler/internal/linkcheck"
+	"github.com/nikhil-thomas/web-crawler/internal/sitemap"
+)
+
+type stubLinkChecker struct {
+	mu       sync.Mutex
+	statuses map[string]int
+	errs     map[string]error
+	checked  []string
+}
+
+func (slc *stubLinkChecker) Check(ctx context.Context, url string) (*crawlers.FetchResult, error) {
+	slc.mu.Lock()
+	slc.checked = append(slc.checked, url)
+	slc.mu.Unlock()
+	if err, ok := slc.errs[url]; ok {
+		return nil, err
+	}
+	status := slc.statuses[url]
+	result := &crawlers.FetchResult{URL: url, StatusCode: status}
+	if status >= 400 {
+		return result, &crawlers.StatusError{URL: url, StatusCode: status}
+	}
+	return result, nil
+}
+
+type stubRobotsChecker struct {
+	disallow []string
+}
+
+func (src *stubRobotsChecker) Allowed(ctx context.Context, url string) bool {
+	for _, prefix := range src.disallow {
+		if strings.HasPrefix(url, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+func (src *stubRobotsChecker) CrawlDelay(ctx context.Context, url string) time.Duration {
+	return 0
+}
+
+func TestChecker(t *testing.T) {
+	dnsErr := &crawlers.FetchError{URL: "https://gone.example.org", Kind: crawlers.ErrDNS, Err: errors.New("no such host")}
+	checker := &stubLinkChecker{
+		statuses: map[string]int{
+			"https://golang.org":               200,
+			"https://example.com/logo.png":     200,
+			"https://example.com/old-logo.png": 404,
+		},
+		errs: map[string]error{
+			"https://gone.example.org": dnsErr,
+		},
+	}
+
+	result := sitemap.NewResult()
+	result.AddPage("https://example.com", 0, &crawlers.FetchResult{StatusCode: 200}, nil)
+	result.AddPage("https://example.com/about.html", 1, &crawlers.FetchResult{StatusCode: 200}, nil)
+	missing := &crawlers.StatusError{URL: "https://example.com/missing.html", StatusCode: 404}
+	result.AddPage("https://example.com/missing.html", 1, &crawlers.FetchResult{StatusCode: 404}, missing)
+	result.AddPage("https://example.com/private.html", 1, nil, crawlers.ErrDisallowedByRobots)
+	result.Graph.AddLinks("https://example.com", []crawlers.Link{
+		{URL: "https://example.com/about.html", Element: "a", Text: "about"},
+		{URL: "https://example.com/missing.html", Element: "a", Text: "missing"},
+		{URL: "https://example.com/private.html", Element: "a", Text: "private"},
+		{URL: "https://example.com/logo.png", Element: "img", Text: "logo"},
+		{URL: "https://golang.org", Element: "a", Text: "go"},
+		{URL: "mailto:info@example.com", Element: "a", Text: "mail us"},
+	})
+	result.Graph.AddLinks("https://example.com/about.html", []crawlers.Link{
+		{URL: "https://example.com/missing.html", Element: "a", Text: "more"},
+		{URL: "https://example.com/old-logo.png", Element: "img", Text: "logo"},
+		{URL: "https://gone.example.org", Element: "a", Text: "partner"},
+	})
+
+	report, err := linkcheck.NewChecker(checker).Check(context.Background(), []string{"https://example.com"}, result.Pages, result.Graph)
+
+	t.Run("it should check only the links which were not crawled", func(t *testing.T) {
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+		if len(report.Links) != 7 {
+			t.Errorf("expected 7 links, got %d", len(report.Links))
+		}
+		expected := map[string]bool{
+			"https://example.com/logo.png":     true,
+			"https://golang.org":               true,
+			"https://example.com/old-logo.png": true,
+			"https://gone.example.org":         true,
+		}
+		got := map[string]bool{}
+		for _, url := range checker.checked {
+			got[url] = true
+		}
+		if len(checker.checked) != len(expected) || !reflect.DeepEqual(expected, got) {
+			t.Errorf("expected %v to be checked, got %v", expected, checker.checked)
+		}
+	})
+
+	t.Run("it should report broken links with the pages linking to them", func(t *testing.T) {
+		broken := report.Broken()
+		var urls []string
+		for _, link := range broken {
+			urls = append(urls, link.URL)
+		}
+		expected := []string{
+			"https://example.com/missing.html",
+			"https://example.com/old-logo.png",
+			"https://gone.example.org",
+		}
+		if !reflect.DeepEqual(expected, urls) {
+			t.Fatalf("expected broken links %v, got %v", expected, urls)
+		}
+
+		if broken[0].StatusCode != 404 || broken[0].Checked || len(broken[0].Referrers) != 2 {
+			t.Errorf("expected crawled page with 404 and 2 referrers, got %+v", broken[0])
+		}
+		if broken[1].StatusCode != 404 || !broken[1].Checked {
+			t.Errorf("expected checked link with 404, got %+v", broken[1])
+		}
+		if broken[2].Outcome != crawlers.OutcomeDNS || !errors.Is(broken[2].Err, crawlers.ErrDNS) {
+			t.Errorf("expected dns failure, got %+v", broken[2])
+		}
+		referrers := []sitemap.Edge{
+			{Source: "https://example.com/about.html", Target: "https://gone.example.org", Text: "partner", Element: "a"},
+		}
+		if !reflect.DeepEqual(referrers, broken[2].Referrers) {
+			t.Errorf("expected referrers %v, got %v", referrers, broken[2].Referrers)
+		}
+	})
+
+	t.Run("it should print broken links", func(t *testing.T) {
+		var buf bytes.Buffer
+		report.Fprint(&buf)
+
+		expected := `
+::::: Broken Links: 3 of 7 ::::
+https://example.com/missing.html : 404
+  https://example.com : "missing" (a)
+  https://example.com/about.html : "more" (a)
+https://example.com/old-logo.png : 404
+  https://example.com/about.html : "logo" (img)
+https://gone.example.org : dns : `
+		if got := buf.String(); !strings.HasPrefix(got, expected) {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	})
+
+	t.Run("it should skip in-scope links disallowed by robots.txt", func(t *testing.T) {
+		checker := &stubLinkChecker{statuses: map[string]int{"https://golang.org": 200}}
+		robots := &stubRobotsChecker{disallow: []string{"https://example.com/logo.png", "https://golang.org"}}
+
+		report, err := linkcheck.NewChecker(checker, crawlers.WithRobots(robots)).Check(context.Background(), []string{"https://example.com"}, result.Pages, result.Graph)
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+		for _, url := range checker.checked {
+			if url == "https://example.com/logo.png" {
+				t.Errorf("expected %s not to be requested", url)
+			}
+		}
+		var skipped []string
+		for _, link := range report.Skipped() {
+			skipped = append(skipped, link.URL)
+			if !errors.Is(link.Err, crawlers.ErrDisallowedByRobots) {
+				t.Errorf("expected %s to be disallowed by robots, got %v", link.URL, link.Err)
+			}
+		}
+		expected := []string{"https://example.com/logo.png", "https://example.com/private.html"}
+		if !reflect.DeepEqual(expected, skipped) {
+			t.Errorf("expected skipped links %v, got %v", expected, skipped)
+		}
+
+		var buf bytes.Buffer
+		report.Fprint(&buf)
+		if !strings.Contains(buf.String(), "::::: Skipped Links: 2 ::::\nhttps://example.com/logo.png : ") {
+			t.Errorf("expected skipped links to be printed, got %s", buf.String())
+		}
+	})
+
+	t.Run("it should stop checking when the context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		checker := &stubLinkChecker{}
+
+		report, err := linkcheck.NewChecker(checker).Check(ctx, []string{"https://example.com"}, result.Pages, result.Graph)
+
+		if err != context.Canceled {
+			t.Errorf("expected %s, got %v", context.Canceled, err)
+		}
+		if len(checker.checked) != 0 {
+			t.Errorf("expected no link to be checked, got %v", checker.checked)
+		}
+		if len(report.Links) != 3 {
+			t.Errorf("expected the 3 crawled links, got %d", len(report.Links))
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+)
+
+// Check returns the status of url without reading its body
+// a HEAD request is sent first, a GET request is sent when HEAD fails with an error status
+// as some servers do not answer HEAD requests
+// robots.txt is not checked as the page is not crawled
+func (f *Fetcher) Check(ctx context.Context, url string) (*crawlers.FetchResult, error) {
+	result, err := f.check(ctx, http.MethodHead, url)
+	if result != nil && result.StatusCode >= http.StatusBadRequest {
+		result, err = f.check(ctx, http.MethodGet, url)
+	}
+	return result, err
+}
+
+// check sends a request to url with method and closes the response without reading its body
+func (f *Fetcher) check(ctx context.Context, method, url string) (*crawlers.FetchResult, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("http fetcher: url : %s : err : %w", url, err)
+	}
+	start := time.Now()
+	resp, retries, err := f.do(ctx, req)
+	if err != nil {
+		err = fetchError(url, err)
+		if retries > 0 {
+			return &crawlers.FetchResult{URL: url, FinalURL: url, Retries: retries}, err
+		}
+		return nil, err
+	}
+	resp.Body.Close()
+
+	result := &crawlers.FetchResult{
+		URL:           url,
+		FinalURL:      resp.Request.URL.String(),
+		StatusCode:    resp.StatusCode,
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: resp.ContentLength,
+		ResponseTime:  time.Since(start),
+		Header:        resp.Header,
+		Retries:       retries,
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return result, &crawlers.StatusError{URL: url, StatusCode: resp.StatusCode}
+	}
+	return result, nil
+}
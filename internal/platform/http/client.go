@@ -0,0 +1,200 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+)
+
+// DefaultUserAgent is the user agent the crawler identifies itself with
+const DefaultUserAgent = "web-crawler"
+
+const (
+	// DefaultTimeout is the time allowed to connect and receive response headers
+	DefaultTimeout = 10 * time.Second
+	// DefaultReadTimeout is the time allowed for a whole request including reading the body
+	DefaultReadTimeout = 30 * time.Second
+	// DefaultMaxBodySize is the largest response body read
+	DefaultMaxBodySize = 10 << 20
+	// maxRedirects is the number of redirects followed for a request
+	maxRedirects = 10
+)
+
+// Option configures a Fetcher
+type Option func(*Fetcher)
+
+// WithRobots makes Fetcher refuse urls disallowed by robots.txt
+func WithRobots(robots crawlers.RobotsChecker) Option {
+	return func(f *Fetcher) {
+		f.robots = robots
+	}
+}
+
+// WithClient makes Fetcher use an existing *http.Client
+// timeout, user agent, header and tls options are ignored when a client is given
+func WithClient(client *http.Client) Option {
+	return func(f *Fetcher) {
+		f.client = client
+	}
+}
+
+// WithTimeout sets the time allowed to connect and receive response headers
+// a timeout of 0 means no timeout
+func WithTimeout(timeout time.Duration) Option {
+	return func(f *Fetcher) {
+		f.timeout = timeout
+	}
+}
+
+// WithReadTimeout sets the time allowed for a whole request including reading the body
+// a timeout of 0 means no timeout
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(f *Fetcher) {
+		f.readTimeout = timeout
+	}
+}
+
+// WithMaxBodySize sets the largest response body read, larger pages fail with crawlers.ErrBodyTooLarge
+// a size of 0 means no limit
+func WithMaxBodySize(size int64) Option {
+	return func(f *Fetcher) {
+		f.maxBodySize = size
+	}
+}
+
+// WithUserAgent sets the User-Agent header of every request
+func WithUserAgent(userAgent string) Option {
+	return func(f *Fetcher) {
+		f.userAgent = userAgent
+	}
+}
+
+// WithHeader adds a static header to every request
+func WithHeader(key, value string) Option {
+	return func(f *Fetcher) {
+		f.header.Add(key, value)
+	}
+}
+
+// WithRootCAs sets the certificate authorities used to verify servers
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(f *Fetcher) {
+		f.tls().RootCAs = pool
+	}
+}
+
+// WithClientCertificate sets the certificate presented to servers asking for one
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(f *Fetcher) {
+		f.tls().Certificates = append(f.tls().Certificates, cert)
+	}
+}
+
+// WithInsecureSkipVerify disables verification of server certificates
+// it should only be used against staging servers
+func WithInsecureSkipVerify() Option {
+	return func(f *Fetcher) {
+		f.tls().InsecureSkipVerify = true
+	}
+}
+
+// NewClient creates and returns the *http.Client a Fetcher with opts would use
+// it lets other components (eg: robots.txt checks) share the fetcher settings
+func NewClient(opts ...Option) *http.Client {
+	return NewFetcher(opts...).Client()
+}
+
+// LoadCertPool returns the system certificate pool extended with PEM encoded certificates from files
+func LoadCertPool(files ...string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	for _, file := range files {
+		pem, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("http fetcher: ca cert : %s", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("http fetcher: ca cert : %s : no certificates found", file)
+		}
+	}
+	return pool, nil
+}
+
+func (f *Fetcher) tls() *tls.Config {
+	if f.tlsConfig == nil {
+		f.tlsConfig = &tls.Config{}
+	}
+	return f.tlsConfig
+}
+
+func (f *Fetcher) newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   f.timeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       f.tlsConfig,
+		TLSHandshakeTimeout:   f.timeout,
+		ResponseHeaderTimeout: f.timeout,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	return &http.Client{
+		Transport: &headerTransport{
+			base:      transport,
+			userAgent: f.userAgent,
+			header:    f.header,
+		},
+		CheckRedirect: checkRedirect,
+		Timeout:       f.readTimeout,
+	}
+}
+
+// checkRedirect stops redirects back to a url already requested
+// and redirect chains longer than maxRedirects with crawlers.ErrRedirectLoop
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("%w : stopped after %d redirects", crawlers.ErrRedirectLoop, len(via))
+	}
+	for _, prev := range via {
+		if prev.URL.String() == req.URL.String() {
+			return fmt.Errorf("%w : %s", crawlers.ErrRedirectLoop, req.URL)
+		}
+	}
+	return nil
+}
+
+// headerTransport adds User-Agent and static headers to every request
+type headerTransport struct {
+	base      http.RoundTripper
+	userAgent string
+	header    http.Header
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (ht *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request it is given
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+len(ht.header)+1)
+	for key, values := range req.Header {
+		r.Header[key] = values
+	}
+	for key, values := range ht.header {
+		r.Header[key] = values
+	}
+	if ht.userAgent != "" {
+		r.Header.Set("User-Agent", ht.userAgent)
+	}
+	return ht.base.RoundTrip(r)
+}
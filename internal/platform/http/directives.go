@@ -0,0 +1,113 @@
+package http
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// robotsDirectives defines the indexing directives of a page
+type robotsDirectives struct {
+	noIndex  bool
+	noFollow bool
+}
+
+// add applies a comma separated list of directives, eg: "noindex, nofollow"
+func (rd *robotsDirectives) add(directives string) {
+	for _, directive := range strings.Split(directives, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "noindex":
+			rd.noIndex = true
+		case "nofollow":
+			rd.noFollow = true
+		case "none":
+			rd.noIndex = true
+			rd.noFollow = true
+		}
+	}
+}
+
+// xRobotsTagOptions are X-Robots-Tag directives which take a value after a colon
+var xRobotsTagOptions = map[string]bool{
+	"unavailable_after": true,
+	"max-snippet":       true,
+	"max-image-preview": true,
+	"max-video-preview": true,
+}
+
+// addXRobotsTag applies the X-Robots-Tag header values meant for userAgent
+// a value may be limited to one crawler, eg: "googlebot: noindex"
+func (rd *robotsDirectives) addXRobotsTag(values []string, userAgent string) {
+	for _, value := range values {
+		if i := strings.Index(value, ":"); i >= 0 {
+			agent := strings.ToLower(strings.TrimSpace(value[:i]))
+			if !xRobotsTagOptions[agent] {
+				if !matchesAgent(agent, userAgent) {
+					continue
+				}
+				value = value[i+1:]
+			}
+		}
+		rd.add(value)
+	}
+}
+
+// matchesAgent reports whether a robots meta name or X-Robots-Tag agent is meant for userAgent
+func matchesAgent(name, userAgent string) bool {
+	name = strings.ToLower(name)
+	if name == "robots" {
+		return true
+	}
+	product := strings.ToLower(userAgent)
+	if i := strings.IndexAny(product, "/ "); i >= 0 {
+		product = product[:i]
+	}
+	return name != "" && name == product
+}
+
+// pageDirectives defines the directives found in the <head> of a html page
+type pageDirectives struct {
+	robotsDirectives
+	baseHref  string
+	canonical string
+}
+
+// parsePageDirectives returns the first <base href>, the first <link rel="canonical">
+// and the <meta name="robots"> directives of a page
+func parsePageDirectives(n *html.Node, userAgent string) pageDirectives {
+	var pd pageDirectives
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "base":
+				if href, ok := lookupAttr(n, "href"); ok && pd.baseHref == "" {
+					pd.baseHref = strings.TrimSpace(href)
+				}
+			case "link":
+				if hasRel(strings.ToLower(getAttr(n, "rel")), "canonical") && pd.canonical == "" {
+					pd.canonical = strings.TrimSpace(getAttr(n, "href"))
+				}
+			case "meta":
+				if matchesAgent(getAttr(n, "name"), userAgent) {
+					pd.add(getAttr(n, "content"))
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return pd
+}
+
+// hasRel reports whether a space separated rel attribute contains value
+func hasRel(rel, value string) bool {
+	for _, r := range strings.Fields(rel) {
+		if r == value {
+			return true
+		}
+	}
+	return false
+}
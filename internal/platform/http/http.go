@@ -1,64 +1,179 @@
 package http
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
 	"golang.org/x/net/html"
 )
 
 // Fetcher implements crawlers.URLFetcher interface
-type Fetcher struct{}
+type Fetcher struct {
+	client      *http.Client
+	robots      crawlers.RobotsChecker
+	userAgent   string
+	header      http.Header
+	timeout     time.Duration
+	readTimeout time.Duration
+	tlsConfig   *tls.Config
+	retry       RetryPolicy
+	maxBodySize int64
+}
 
 // NewFetcher creates and returns a Fetcher
-func NewFetcher() *Fetcher {
-	return &Fetcher{}
+func NewFetcher(opts ...Option) *Fetcher {
+	f := &Fetcher{
+		userAgent:   DefaultUserAgent,
+		header:      http.Header{},
+		timeout:     DefaultTimeout,
+		readTimeout: DefaultReadTimeout,
+		maxBodySize: DefaultMaxBodySize,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	if f.client == nil {
+		f.client = f.newClient()
+	}
+	return f
+}
+
+// Client returns the *http.Client used by Fetcher
+func (f *Fetcher) Client() *http.Client {
+	return f.client
 }
 
 // ExtractURLs returns all the links from a page
-// only links from anchor tags(<a href="url"></a>) are returned
+// links from every element handled by parseHTMLLinks are returned
 func (f *Fetcher) ExtractURLs(url string) ([]string, error) {
-	resp, err := http.Get(url)
+	result, err := f.Fetch(context.Background(), url)
 	if err != nil {
-		return nil, fmt.Errorf("http fetcher: url : %s : err : %v", url, err)
+		return nil, err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http fetcher: http.Get status code: %d", resp.StatusCode)
+	return crawlers.URLs(result.Links), nil
+}
+
+// Fetch fetches a page and returns its response metadata and links
+// when the server responded the result is returned along with any error
+// failed requests are retried as the retry policy says, the result holds the number of retries
+// cancelling ctx aborts the request
+func (f *Fetcher) Fetch(ctx context.Context, url string) (*crawlers.FetchResult, error) {
+	if f.robots != nil && !f.robots.Allowed(ctx, url) {
+		return nil, crawlers.ErrDisallowedByRobots
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("http fetcher: url : %s : err : %w", url, err)
+	}
+	start := time.Now()
+	resp, retries, err := f.do(ctx, req)
+	if err != nil {
+		err = fetchError(url, err)
+		if retries > 0 {
+			return &crawlers.FetchResult{URL: url, FinalURL: url, Retries: retries}, err
+		}
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	result := &crawlers.FetchResult{
+		URL:           url,
+		FinalURL:      resp.Request.URL.String(),
+		StatusCode:    resp.StatusCode,
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: resp.ContentLength,
+		ResponseTime:  time.Since(start),
+		Header:        resp.Header,
+		Retries:       retries,
+	}
+
+	var directives robotsDirectives
+	directives.addXRobotsTag(resp.Header["X-Robots-Tag"], f.userAgent)
+	result.NoIndex, result.NoFollow = directives.noIndex, directives.noFollow
+
+	if resp.StatusCode != http.StatusOK {
+		return result, &crawlers.StatusError{URL: url, StatusCode: resp.StatusCode}
+	}
+
 	if !isHTML(resp) {
-		return nil, crawlers.ErrPageNotHTML
+		return result, crawlers.ErrPageNotHTML
 	}
 
-	rootNode, err := html.Parse(resp.Body)
+	if f.maxBodySize > 0 && resp.ContentLength > f.maxBodySize {
+		return result, &crawlers.FetchError{URL: url, Kind: crawlers.ErrBodyTooLarge, Err: crawlers.ErrBodyTooLarge}
+	}
+	body := &countingReader{r: resp.Body, max: f.maxBodySize}
+	rootNode, err := html.Parse(body)
 	if err != nil {
-		return nil, fmt.Errorf("http fetcher: %s", err)
+		return result, fetchError(url, err)
+	}
+	if result.ContentLength < 0 {
+		result.ContentLength = body.n
+	}
+
+	result.Title = pageTitle(rootNode)
+
+	page := parsePageDirectives(rootNode, f.userAgent)
+	result.NoIndex = result.NoIndex || page.noIndex
+	result.NoFollow = result.NoFollow || page.noFollow
+
+	// relative links are resolved against <base href> when the page sets one
+	base := resp.Request.URL
+	if page.baseHref != "" {
+		if baseURL, err := base.Parse(page.baseHref); err == nil {
+			base = baseURL
+		}
+	}
+
+	if page.canonical != "" {
+		if canonical, err := base.Parse(page.canonical); err == nil {
+			result.Canonical = canonical.String()
+		}
 	}
 
-	var links []string
-	rawLinks := walkDOM(rootNode, parseHTMLAnchorTag)
+	rawLinks := walkDOM(rootNode, parseHTMLLinks)
 
 	for _, link := range rawLinks {
-		absoluteLink, err := resp.Request.URL.Parse(link)
+		absoluteLink, err := base.Parse(link.URL)
 		if err != nil {
 			continue
 		}
-		links = append(links, absoluteLink.String())
+		link.URL = absoluteLink.String()
+		link.NoFollow = result.NoFollow || hasRel(link.Rel, "nofollow")
+		result.Links = append(result.Links, link)
 	}
 
-	return links, nil
+	return result, nil
 }
 
-func walkDOM(n *html.Node, fn func(n *html.Node) (string, bool)) []string {
-	var links []string
+// countingReader counts the bytes read from r
+// it gives the body size when the server does not send Content-Length
+// reading more than max bytes fails with crawlers.ErrBodyTooLarge, 0 means no limit
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	if cr.max > 0 && cr.n > cr.max {
+		return n, crawlers.ErrBodyTooLarge
+	}
+	return n, err
+}
+
+func walkDOM(n *html.Node, fn func(n *html.Node) []crawlers.Link) []crawlers.Link {
+	var links []crawlers.Link
 	if fn != nil {
-		link, ok := fn(n)
-		if ok {
-			links = append(links, link)
-		}
+		links = append(links, fn(n)...)
 	}
 	for child := n.FirstChild; child != nil; child = child.NextSibling {
 		childLinks := walkDOM(child, fn)
@@ -67,17 +182,155 @@ func walkDOM(n *html.Node, fn func(n *html.Node) (string, bool)) []string {
 	return links
 }
 
-func parseHTMLAnchorTag(node *html.Node) (string, bool) {
-	if node.Type == html.ElementNode && node.Data == "a" {
-		for _, attr := range node.Attr {
-			if attr.Key == "href" {
-				return attr.Val, true
+// linkAttributes maps html elements to the attributes holding links
+var linkAttributes = map[string][]string{
+	"a":      {"href"},
+	"area":   {"href"},
+	"link":   {"href"},
+	"iframe": {"src"},
+	"frame":  {"src"},
+	"img":    {"src", "srcset"},
+	"script": {"src"},
+	"source": {"src", "srcset"},
+	"form":   {"action"},
+}
+
+// parseHTMLLinks returns the links of an element node
+// links come from the elements in linkAttributes and from <meta http-equiv="refresh">
+func parseHTMLLinks(node *html.Node) []crawlers.Link {
+	if node.Type != html.ElementNode {
+		return nil
+	}
+	if node.Data == "meta" {
+		return parseHTMLMetaRefresh(node)
+	}
+	keys, ok := linkAttributes[node.Data]
+	if !ok {
+		return nil
+	}
+
+	var links []crawlers.Link
+	rel := strings.ToLower(getAttr(node, "rel"))
+	text := linkText(node)
+	for _, key := range keys {
+		val, ok := lookupAttr(node, key)
+		if !ok {
+			continue
+		}
+		if key == "srcset" {
+			for _, u := range parseSrcset(val) {
+				links = append(links, crawlers.Link{URL: u, Element: node.Data, Attribute: key, Rel: rel, Text: text})
+			}
+			continue
+		}
+		links = append(links, crawlers.Link{URL: strings.TrimSpace(val), Element: node.Data, Attribute: key, Rel: rel, Text: text})
+	}
+	return links
+}
+
+// linkText returns the anchor text of a link element
+// the text of an anchor wrapping only an image is the alt text of the image
+func linkText(node *html.Node) string {
+	switch node.Data {
+	case "a":
+		var text, alt []string
+		walkNodes(node, func(n *html.Node) {
+			switch {
+			case n.Type == html.TextNode:
+				text = append(text, n.Data)
+			case n.Type == html.ElementNode && n.Data == "img":
+				alt = append(alt, getAttr(n, "alt"))
+			}
+		})
+		if t := strings.Join(strings.Fields(strings.Join(text, " ")), " "); t != "" {
+			return t
+		}
+		return strings.Join(strings.Fields(strings.Join(alt, " ")), " ")
+	case "area", "img":
+		return strings.Join(strings.Fields(getAttr(node, "alt")), " ")
+	}
+	return ""
+}
+
+// pageTitle returns the text of the first <title> of a page
+func pageTitle(n *html.Node) string {
+	if n.Type == html.ElementNode && n.Data == "title" {
+		var text []string
+		walkNodes(n, func(n *html.Node) {
+			if n.Type == html.TextNode {
+				text = append(text, n.Data)
 			}
+		})
+		return strings.Join(strings.Fields(strings.Join(text, " ")), " ")
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if title := pageTitle(child); title != "" {
+			return title
+		}
+	}
+	return ""
+}
+
+// walkNodes calls fn for every descendant of n
+func walkNodes(n *html.Node, fn func(n *html.Node)) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		fn(child)
+		walkNodes(child, fn)
+	}
+}
+
+// parseHTMLMetaRefresh returns the link of <meta http-equiv="refresh" content="5; url=...">
+func parseHTMLMetaRefresh(node *html.Node) []crawlers.Link {
+	if !strings.EqualFold(getAttr(node, "http-equiv"), "refresh") {
+		return nil
+	}
+	content := getAttr(node, "content")
+	i := strings.Index(content, ";")
+	if i < 0 {
+		return nil
+	}
+	target := strings.TrimSpace(content[i+1:])
+	if len(target) < 4 || !strings.EqualFold(target[:3], "url") {
+		return nil
+	}
+	target = strings.TrimSpace(target[3:])
+	if !strings.HasPrefix(target, "=") {
+		return nil
+	}
+	target = strings.Trim(strings.TrimSpace(target[1:]), `'"`)
+	if target == "" {
+		return nil
+	}
+	return []crawlers.Link{{URL: target, Element: "meta", Attribute: "content"}}
+}
+
+// parseSrcset returns the urls of a srcset attribute
+// eg: "small.jpg 480w, large.jpg 1080w"
+func parseSrcset(srcset string) []string {
+	var urls []string
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+	return urls
+}
+
+func lookupAttr(node *html.Node, key string) (string, bool) {
+	for _, attr := range node.Attr {
+		if attr.Key == key {
+			return attr.Val, true
 		}
 	}
 	return "", false
 }
 
+func getAttr(node *html.Node, key string) string {
+	val, _ := lookupAttr(node, key)
+	return val
+}
+
 func isHTML(resp *http.Response) bool {
 	ct := resp.Header.Get("Content-Type")
 	if ct != "text/html" && !strings.HasPrefix(ct, "text/html;") {
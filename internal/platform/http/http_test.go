@@ -1,11 +1,15 @@
 package http_test
 
 import (
+	"context"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	nethttp "net/http"
 	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
 	"github.com/nikhil-thomas/web-crawler/internal/platform/http"
@@ -34,6 +38,44 @@ func htmlPageHandler(w nethttp.ResponseWriter, r *nethttp.Request) {
 	w.Write([]byte(pageContent))
 }
 
+func richPageHandler(w nethttp.ResponseWriter, r *nethttp.Request) {
+	pageContent := `<!DOCTYPE html>
+    <html lang="en">
+    <head>
+        <meta http-equiv="refresh" content="30; URL='/refreshed.html'">
+        <link rel="stylesheet" href="/style.css">
+        <script src="/app.js"></script>
+    </head>
+    <body>
+        <a href="/about.html">about</a>
+        <a href="/home.html"><img src="/home.png" alt="home  page"></a>
+        <map name="nav"><area href="/area.html" alt="docs"></map>
+        <iframe src="/frame.html"></iframe>
+        <img src="/logo.png" alt="logo" srcset="/logo-2x.png 2x, /logo-3x.png 3x">
+        <picture><source srcset="/hero.webp"></picture>
+        <form action="/search"></form>
+    </body>
+    </html>`
+	w.Write([]byte(pageContent))
+}
+
+func directivesPageHandler(w nethttp.ResponseWriter, r *nethttp.Request) {
+	pageContent := `<!DOCTYPE html>
+    <html lang="en">
+    <head>
+        <base href="/docs/v2/">
+        <link rel="canonical" href="index.html">
+        <meta name="robots" content="noindex">
+    </head>
+    <body>
+        <a href="intro.html">intro</a>
+        <a href="/login" rel="nofollow noopener">login</a>
+    </body>
+    </html>`
+	w.Header().Set("X-Robots-Tag", "otherbot: nofollow")
+	w.Write([]byte(pageContent))
+}
+
 func jsonHandler(w nethttp.ResponseWriter, r *nethttp.Request) {
 	data := map[string]string{
 		"key1": "val1",
@@ -96,3 +138,527 @@ func TestExtractURLs(t *testing.T) {
 		}
 	})
 }
+
+func TestFetch(t *testing.T) {
+	r := nethttp.NewServeMux()
+	r.Handle("/index.html", nethttp.HandlerFunc(htmlPageHandler))
+	r.Handle("/data.json", nethttp.HandlerFunc(jsonHandler))
+	r.Handle("/home", nethttp.RedirectHandler("/index.html", nethttp.StatusMovedPermanently))
+	r.Handle("/rich.html", nethttp.HandlerFunc(richPageHandler))
+	r.Handle("/directives.html", nethttp.HandlerFunc(directivesPageHandler))
+	r.Handle("/private.pdf", nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("X-Robots-Tag", "web-crawler: none")
+	}))
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	t.Run("it should honor base href, canonical, nofollow and robots directives", func(t *testing.T) {
+		fetcher := http.NewFetcher()
+		result, err := fetcher.Fetch(context.Background(), server.URL+"/directives.html")
+
+		if err != nil {
+			t.Errorf("error unexpected, got %s", err)
+		}
+
+		if !result.NoIndex || result.NoFollow {
+			t.Errorf("expected noindex page, got noindex %t nofollow %t", result.NoIndex, result.NoFollow)
+		}
+
+		if result.Canonical != server.URL+"/docs/v2/index.html" {
+			t.Errorf("expected canonical url %s, got %s", server.URL+"/docs/v2/index.html", result.Canonical)
+		}
+
+		expected := []crawlers.Link{
+			{URL: server.URL + "/docs/v2/index.html", Element: "link", Attribute: "href", Rel: "canonical"},
+			{URL: server.URL + "/docs/v2/intro.html", Element: "a", Attribute: "href", Text: "intro"},
+			{URL: server.URL + "/login", Element: "a", Attribute: "href", Rel: "nofollow noopener", Text: "login", NoFollow: true},
+		}
+
+		if !reflect.DeepEqual(expected, result.Links) {
+			t.Errorf("expected %v, got %v", expected, result.Links)
+		}
+	})
+
+	t.Run("it should honor X-Robots-Tag of non html pages", func(t *testing.T) {
+		fetcher := http.NewFetcher()
+		result, _ := fetcher.Fetch(context.Background(), server.URL+"/private.pdf")
+
+		if result == nil || !result.NoIndex || !result.NoFollow {
+			t.Errorf("expected noindex, nofollow page, got %+v", result)
+		}
+	})
+
+	t.Run("it should extract links of every element kind", func(t *testing.T) {
+		fetcher := http.NewFetcher()
+		result, err := fetcher.Fetch(context.Background(), server.URL+"/rich.html")
+
+		if err != nil {
+			t.Errorf("error unexpected, got %s", err)
+		}
+
+		expected := []crawlers.Link{
+			{URL: server.URL + "/refreshed.html", Element: "meta", Attribute: "content"},
+			{URL: server.URL + "/style.css", Element: "link", Attribute: "href", Rel: "stylesheet"},
+			{URL: server.URL + "/app.js", Element: "script", Attribute: "src"},
+			{URL: server.URL + "/about.html", Element: "a", Attribute: "href", Text: "about"},
+			{URL: server.URL + "/home.html", Element: "a", Attribute: "href", Text: "home page"},
+			{URL: server.URL + "/home.png", Element: "img", Attribute: "src", Text: "home page"},
+			{URL: server.URL + "/area.html", Element: "area", Attribute: "href", Text: "docs"},
+			{URL: server.URL + "/frame.html", Element: "iframe", Attribute: "src"},
+			{URL: server.URL + "/logo.png", Element: "img", Attribute: "src", Text: "logo"},
+			{URL: server.URL + "/logo-2x.png", Element: "img", Attribute: "srcset", Text: "logo"},
+			{URL: server.URL + "/logo-3x.png", Element: "img", Attribute: "srcset", Text: "logo"},
+			{URL: server.URL + "/hero.webp", Element: "source", Attribute: "srcset"},
+			{URL: server.URL + "/search", Element: "form", Attribute: "action"},
+		}
+
+		if !reflect.DeepEqual(expected, result.Links) {
+			t.Errorf("expected %v, got %v", expected, result.Links)
+		}
+	})
+
+	t.Run("it should return response metadata along with links", func(t *testing.T) {
+		fetcher := http.NewFetcher()
+		result, err := fetcher.Fetch(context.Background(), server.URL+"/home")
+
+		if err != nil {
+			t.Errorf("error unexpected, got %s", err)
+		}
+
+		if result.URL != server.URL+"/home" {
+			t.Errorf("expected %s, got %s", server.URL+"/home", result.URL)
+		}
+		if result.FinalURL != server.URL+"/index.html" {
+			t.Errorf("expected %s, got %s", server.URL+"/index.html", result.FinalURL)
+		}
+		if result.StatusCode != nethttp.StatusOK {
+			t.Errorf("expected %d, got %d", nethttp.StatusOK, result.StatusCode)
+		}
+		if result.ContentType != "text/html; charset=utf-8" {
+			t.Errorf("expected %s, got %s", "text/html; charset=utf-8", result.ContentType)
+		}
+		if result.ContentLength <= 0 {
+			t.Errorf("expected content length, got %d", result.ContentLength)
+		}
+		if result.Title != "Document" {
+			t.Errorf("expected title %s, got %s", "Document", result.Title)
+		}
+		if len(result.Links) != 3 {
+			t.Errorf("expected %d, got %d", 3, len(result.Links))
+		}
+	})
+
+	t.Run("it should return response metadata of non html pages", func(t *testing.T) {
+		fetcher := http.NewFetcher()
+		result, err := fetcher.Fetch(context.Background(), server.URL+"/data.json")
+
+		if err != crawlers.ErrPageNotHTML {
+			t.Errorf("expected %s, but got %s", crawlers.ErrPageNotHTML, err)
+		}
+		if result == nil || result.ContentType != "application/json" {
+			t.Errorf("expected content type application/json, got %+v", result)
+		}
+	})
+
+	t.Run("it should return the status code of failed pages", func(t *testing.T) {
+		fetcher := http.NewFetcher()
+		result, err := fetcher.Fetch(context.Background(), server.URL+"/missing.html")
+
+		if err == nil {
+			t.Error("error expected, got nil")
+		}
+		if result == nil || result.StatusCode != nethttp.StatusNotFound {
+			t.Errorf("expected status code %d, got %+v", nethttp.StatusNotFound, result)
+		}
+		var statusErr *crawlers.StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != nethttp.StatusNotFound {
+			t.Errorf("expected status error with code %d, got %v", nethttp.StatusNotFound, err)
+		}
+	})
+
+	t.Run("it should stop redirect loops", func(t *testing.T) {
+		server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			if r.URL.Path == "/a" {
+				nethttp.Redirect(w, r, "/b", nethttp.StatusFound)
+				return
+			}
+			nethttp.Redirect(w, r, "/a", nethttp.StatusFound)
+		}))
+		defer server.Close()
+
+		_, err := http.NewFetcher().Fetch(context.Background(), server.URL+"/a")
+
+		if !errors.Is(err, crawlers.ErrRedirectLoop) {
+			t.Errorf("expected %s, got %v", crawlers.ErrRedirectLoop, err)
+		}
+	})
+
+	t.Run("it should refuse bodies larger than the maximum size", func(t *testing.T) {
+		fetcher := http.NewFetcher(http.WithMaxBodySize(64))
+
+		_, err := fetcher.Fetch(context.Background(), server.URL+"/index.html")
+
+		if !errors.Is(err, crawlers.ErrBodyTooLarge) {
+			t.Errorf("expected %s, got %v", crawlers.ErrBodyTooLarge, err)
+		}
+		if outcome := crawlers.Classify(nil, err); outcome != crawlers.OutcomeTooLarge {
+			t.Errorf("expected outcome %s, got %s", crawlers.OutcomeTooLarge, outcome)
+		}
+	})
+
+	t.Run("it should abort the request when the context is cancelled", func(t *testing.T) {
+		release := make(chan bool)
+		server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		fetcher := http.NewFetcher()
+
+		start := time.Now()
+		_, err := fetcher.Fetch(ctx, server.URL)
+		if err == nil {
+			t.Error("error expected, got nil")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected request to be cancelled after 50ms, took %s", elapsed)
+		}
+	})
+}
+
+func TestFetcherOptions(t *testing.T) {
+	var gotHeader nethttp.Header
+	headerHandler := nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		gotHeader = r.Header
+		htmlPageHandler(w, r)
+	})
+
+	t.Run("it should send user agent and extra headers", func(t *testing.T) {
+		server := httptest.NewServer(headerHandler)
+		defer server.Close()
+
+		fetcher := http.NewFetcher(
+			http.WithUserAgent("test-crawler/1.0"),
+			http.WithHeader("X-Crawl-Token", "secret"),
+		)
+		_, err := fetcher.ExtractURLs(server.URL)
+		if err != nil {
+			t.Errorf("error unexpected, got %s", err)
+		}
+
+		if got := gotHeader.Get("User-Agent"); got != "test-crawler/1.0" {
+			t.Errorf("expected %s, got %s", "test-crawler/1.0", got)
+		}
+		if got := gotHeader.Get("X-Crawl-Token"); got != "secret" {
+			t.Errorf("expected %s, got %s", "secret", got)
+		}
+	})
+
+	t.Run("it should stop waiting for a hung server", func(t *testing.T) {
+		release := make(chan bool)
+		server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+
+		fetcher := http.NewFetcher(http.WithTimeout(50 * time.Millisecond))
+
+		start := time.Now()
+		_, err := fetcher.ExtractURLs(server.URL)
+		if err == nil {
+			t.Error("error expected, got nil")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected request to time out after 50ms, took %s", elapsed)
+		}
+	})
+
+	t.Run("it should report timeouts as the outcome of the fetch", func(t *testing.T) {
+		release := make(chan bool)
+		server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+
+		fetcher := http.NewFetcher(http.WithTimeout(50 * time.Millisecond))
+
+		result, err := fetcher.Fetch(context.Background(), server.URL)
+		if !errors.Is(err, crawlers.ErrTimeout) {
+			t.Errorf("expected %s, got %v", crawlers.ErrTimeout, err)
+		}
+		if outcome := crawlers.Classify(result, err); outcome != crawlers.OutcomeTimeout {
+			t.Errorf("expected outcome %s, got %s (%v)", crawlers.OutcomeTimeout, outcome, err)
+		}
+	})
+
+	t.Run("it should stop reading a slow body", func(t *testing.T) {
+		release := make(chan bool)
+		server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body><a href=\"/about.html\">"))
+			w.(nethttp.Flusher).Flush()
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+
+		fetcher := http.NewFetcher(http.WithReadTimeout(50 * time.Millisecond))
+
+		_, err := fetcher.ExtractURLs(server.URL)
+		if err == nil {
+			t.Error("error expected, got nil")
+		}
+	})
+
+	t.Run("it should trust custom root certificate authorities", func(t *testing.T) {
+		server := httptest.NewTLSServer(headerHandler)
+		defer server.Close()
+
+		_, err := http.NewFetcher().ExtractURLs(server.URL)
+		if !errors.Is(err, crawlers.ErrTLS) {
+			t.Errorf("expected %s for unknown certificate authority, got %v", crawlers.ErrTLS, err)
+		}
+
+		pool := x509.NewCertPool()
+		pool.AddCert(server.Certificate())
+		_, err = http.NewFetcher(http.WithRootCAs(pool)).ExtractURLs(server.URL)
+		if err != nil {
+			t.Errorf("error unexpected, got %s", err)
+		}
+
+		_, err = http.NewFetcher(http.WithInsecureSkipVerify()).ExtractURLs(server.URL)
+		if err != nil {
+			t.Errorf("error unexpected, got %s", err)
+		}
+	})
+}
+
+// stubThrottle records the waits asked for without waiting
+type stubThrottle struct {
+	waits []time.Duration
+}
+
+func (st *stubThrottle) Backoff(ctx context.Context, url string, wait time.Duration) error {
+	st.waits = append(st.waits, wait)
+	return nil
+}
+
+func TestRetry(t *testing.T) {
+	// flakyHandler fails the first failures requests to a path with status
+	flakyHandler := func(failures int, status int, header nethttp.Header) (nethttp.Handler, *int) {
+		requests := 0
+		return nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			requests++
+			if requests <= failures {
+				for key, values := range header {
+					w.Header()[key] = values
+				}
+				w.WriteHeader(status)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			htmlPageHandler(w, r)
+		}), &requests
+	}
+
+	policy := http.DefaultRetryPolicy()
+	policy.BaseDelay = 10 * time.Millisecond
+
+	t.Run("it should retry statuses of the policy and count the retries", func(t *testing.T) {
+		handler, requests := flakyHandler(2, nethttp.StatusServiceUnavailable, nil)
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		result, err := http.NewFetcher(http.WithRetry(policy)).Fetch(context.Background(), server.URL)
+
+		if err != nil {
+			t.Errorf("error unexpected, got %s", err)
+		}
+		if *requests != 3 {
+			t.Errorf("expected 3 requests, got %d", *requests)
+		}
+		if result == nil || result.Retries != 2 || len(result.Links) != 3 {
+			t.Errorf("expected page with 2 retries, got %+v", result)
+		}
+	})
+
+	t.Run("it should give up after the maximum attempts", func(t *testing.T) {
+		handler, requests := flakyHandler(5, nethttp.StatusBadGateway, nil)
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		result, err := http.NewFetcher(http.WithRetry(policy)).Fetch(context.Background(), server.URL)
+
+		if err == nil {
+			t.Error("error expected, got nil")
+		}
+		if *requests != policy.MaxAttempts {
+			t.Errorf("expected %d requests, got %d", policy.MaxAttempts, *requests)
+		}
+		if result == nil || result.StatusCode != nethttp.StatusBadGateway || result.Retries != 2 {
+			t.Errorf("expected status code %d after 2 retries, got %+v", nethttp.StatusBadGateway, result)
+		}
+	})
+
+	t.Run("it should not retry other statuses", func(t *testing.T) {
+		handler, requests := flakyHandler(1, nethttp.StatusInternalServerError, nil)
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		http.NewFetcher(http.WithRetry(policy)).Fetch(context.Background(), server.URL)
+
+		if *requests != 1 {
+			t.Errorf("expected 1 request, got %d", *requests)
+		}
+	})
+
+	t.Run("it should wait as long as Retry-After asks", func(t *testing.T) {
+		handler, requests := flakyHandler(1, nethttp.StatusTooManyRequests, nethttp.Header{"Retry-After": {"1"}})
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		start := time.Now()
+		_, err := http.NewFetcher(http.WithRetry(policy)).Fetch(context.Background(), server.URL)
+
+		if err != nil {
+			t.Errorf("error unexpected, got %s", err)
+		}
+		if elapsed := time.Since(start); elapsed < time.Second {
+			t.Errorf("expected retry after 1s, took %s", elapsed)
+		}
+		if *requests != 2 {
+			t.Errorf("expected 2 requests, got %d", *requests)
+		}
+
+		// a wait longer than the policy allows is not retried
+		handler, requests = flakyHandler(1, nethttp.StatusTooManyRequests, nethttp.Header{"Retry-After": {"3600"}})
+		server = httptest.NewServer(handler)
+		defer server.Close()
+
+		result, _ := http.NewFetcher(http.WithRetry(policy)).Fetch(context.Background(), server.URL)
+
+		if *requests != 1 || result == nil || result.StatusCode != nethttp.StatusTooManyRequests {
+			t.Errorf("expected 1 request with status code %d, got %d requests", nethttp.StatusTooManyRequests, *requests)
+		}
+	})
+
+	t.Run("it should wait on the throttle of the crawl before retrying", func(t *testing.T) {
+		handler, requests := flakyHandler(1, nethttp.StatusTooManyRequests, nethttp.Header{"Retry-After": {"1"}})
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		throttle := &stubThrottle{}
+		ctx := crawlers.WithThrottle(context.Background(), throttle)
+		start := time.Now()
+		_, err := http.NewFetcher(http.WithRetry(policy)).Fetch(ctx, server.URL)
+
+		if err != nil {
+			t.Errorf("error unexpected, got %s", err)
+		}
+		if *requests != 2 {
+			t.Errorf("expected 2 requests, got %d", *requests)
+		}
+		if len(throttle.waits) != 1 || throttle.waits[0] < time.Second {
+			t.Errorf("expected the throttle to be asked for the 1s Retry-After, got %v", throttle.waits)
+		}
+		if elapsed := time.Since(start); elapsed >= time.Second {
+			t.Errorf("expected the throttle to do the waiting, took %s", elapsed)
+		}
+	})
+
+	t.Run("it should retry refused connections", func(t *testing.T) {
+		server := httptest.NewServer(nethttp.HandlerFunc(htmlPageHandler))
+		url := server.URL
+		server.Close()
+
+		result, err := http.NewFetcher(http.WithRetry(policy)).Fetch(context.Background(), url)
+
+		if !errors.Is(err, crawlers.ErrConnectionRefused) {
+			t.Errorf("expected %s, got %v", crawlers.ErrConnectionRefused, err)
+		}
+		if result == nil || result.Retries != 2 {
+			t.Errorf("expected 2 retries, got %+v", result)
+		}
+
+		policy := policy
+		policy.Errors = nil
+		result, _ = http.NewFetcher(http.WithRetry(policy)).Fetch(context.Background(), url)
+
+		if result != nil {
+			t.Errorf("expected no retries, got %+v", result)
+		}
+	})
+
+	t.Run("it should reject unknown transport errors", func(t *testing.T) {
+		if _, err := http.ParseTransportErrors([]string{"timeout", "gremlins"}); err == nil {
+			t.Error("error expected, got nil")
+		}
+	})
+}
+
+func TestCheck(t *testing.T) {
+	var methods []string
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		methods = append(methods, r.Method)
+		switch r.URL.Path {
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html")
+		case "/no-head.html":
+			if r.Method == nethttp.MethodHead {
+				w.WriteHeader(nethttp.StatusMethodNotAllowed)
+			}
+		default:
+			nethttp.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Run("it should check a url with a HEAD request", func(t *testing.T) {
+		methods = nil
+		result, err := http.NewFetcher().Check(context.Background(), server.URL+"/page.html")
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+		if result == nil || result.StatusCode != nethttp.StatusOK || result.ContentType != "text/html" {
+			t.Errorf("expected status code %d of a html page, got %+v", nethttp.StatusOK, result)
+		}
+		if expected := []string{nethttp.MethodHead}; !reflect.DeepEqual(expected, methods) {
+			t.Errorf("expected requests %v, got %v", expected, methods)
+		}
+	})
+
+	t.Run("it should fall back to GET when HEAD fails", func(t *testing.T) {
+		methods = nil
+		result, err := http.NewFetcher().Check(context.Background(), server.URL+"/no-head.html")
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+		if result == nil || result.StatusCode != nethttp.StatusOK {
+			t.Errorf("expected status code %d, got %+v", nethttp.StatusOK, result)
+		}
+		if expected := []string{nethttp.MethodHead, nethttp.MethodGet}; !reflect.DeepEqual(expected, methods) {
+			t.Errorf("expected requests %v, got %v", expected, methods)
+		}
+	})
+
+	t.Run("it should return the status code of broken links", func(t *testing.T) {
+		result, err := http.NewFetcher().Check(context.Background(), server.URL+"/missing.html")
+
+		var statusErr *crawlers.StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != nethttp.StatusNotFound {
+			t.Errorf("expected status error with code %d, got %v", nethttp.StatusNotFound, err)
+		}
+		if result == nil || result.StatusCode != nethttp.StatusNotFound {
+			t.Errorf("expected status code %d, got %+v", nethttp.StatusNotFound, result)
+		}
+	})
+}
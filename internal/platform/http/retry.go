@@ -0,0 +1,267 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+	log "github.com/sirupsen/logrus"
+)
+
+// TransportError defines a class of errors a request can fail with before a response is received
+type TransportError string
+
+const (
+	// ErrorTimeout is a request which timed out
+	ErrorTimeout TransportError = "timeout"
+	// ErrorRefused is a connection refused by the server
+	ErrorRefused TransportError = "refused"
+	// ErrorReset is a connection reset by the server
+	ErrorReset TransportError = "reset"
+	// ErrorEOF is a connection closed by the server before a response was sent
+	ErrorEOF TransportError = "eof"
+	// ErrorDNS is a temporary failure to resolve the host name
+	ErrorDNS TransportError = "dns"
+)
+
+// ParseTransportErrors returns the transport errors named in names
+func ParseTransportErrors(names []string) ([]TransportError, error) {
+	var errs []TransportError
+	for _, name := range names {
+		switch te := TransportError(name); te {
+		case ErrorTimeout, ErrorRefused, ErrorReset, ErrorEOF, ErrorDNS:
+			errs = append(errs, te)
+		default:
+			return nil, fmt.Errorf("retry : unknown transport error %q : expected one of timeout, refused, reset, eof, dns", name)
+		}
+	}
+	return errs, nil
+}
+
+// RetryPolicy defines which failed requests are retried and how long to wait between attempts
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of requests made for a url
+	// a policy with 1 attempt or less never retries
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry, it doubles with every retry
+	// waits are jittered so that failed requests are not retried together
+	BaseDelay time.Duration
+	// MaxDelay caps the wait between two attempts
+	MaxDelay time.Duration
+	// Statuses are the response status codes which are retried
+	Statuses []int
+	// Errors are the transport errors which are retried
+	Errors []TransportError
+	// MaxRetryAfter is the longest Retry-After honored
+	// a response asking for a longer wait is not retried
+	MaxRetryAfter time.Duration
+}
+
+// DefaultRetryPolicy returns a policy retrying transient failures twice
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+		Statuses: []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+		Errors:        []TransportError{ErrorTimeout, ErrorRefused, ErrorReset, ErrorEOF, ErrorDNS},
+		MaxRetryAfter: 2 * time.Minute,
+	}
+}
+
+// WithRetry makes Fetcher retry failed requests as policy says
+func WithRetry(policy RetryPolicy) Option {
+	return func(f *Fetcher) {
+		f.retry = policy
+	}
+}
+
+// retryStatus reports whether a response with status code is retried
+func (rp RetryPolicy) retryStatus(status int) bool {
+	for _, s := range rp.Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// retryError reports whether a request which failed with err is retried
+func (rp RetryPolicy) retryError(err error) bool {
+	class, transient := classify(err)
+	if !transient {
+		return false
+	}
+	for _, te := range rp.Errors {
+		if te == class {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the wait before retry number retry, counting from 1
+func (rp RetryPolicy) backoff(retry int) time.Duration {
+	delay := rp.BaseDelay
+	for i := 1; i < retry && (rp.MaxDelay <= 0 || delay < rp.MaxDelay); i++ {
+		delay *= 2
+	}
+	if rp.MaxDelay > 0 && delay > rp.MaxDelay {
+		delay = rp.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// wait between half and all of the delay
+	half := int64(delay / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// classify returns the class of a transport error and whether it may go away on retry
+// errors of no known class are never transient
+func classify(err error) (TransportError, bool) {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorTimeout, true
+	}
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr):
+		return ErrorDNS, dnsErr.Temporary() || dnsErr.Timeout()
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorRefused, true
+	case errors.Is(err, syscall.ECONNRESET):
+		return ErrorReset, true
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorEOF, true
+	}
+	return "", false
+}
+
+// fetchError returns the error of a request to url which failed with err
+// the error matches the errors of the crawlers taxonomy with errors.Is
+func fetchError(url string, err error) error {
+	fe := &crawlers.FetchError{URL: url, Err: err}
+	switch class, _ := classify(err); {
+	case class == ErrorTimeout:
+		fe.Kind = crawlers.ErrTimeout
+	case class == ErrorDNS:
+		fe.Kind = crawlers.ErrDNS
+	case class == ErrorRefused:
+		fe.Kind = crawlers.ErrConnectionRefused
+	case isTLSError(err):
+		fe.Kind = crawlers.ErrTLS
+	}
+	return fe
+}
+
+// isTLSError reports whether err is a failed tls handshake or an invalid certificate
+func isTLSError(err error) bool {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		recordHeader     tls.RecordHeaderError
+	)
+	return errors.As(err, &unknownAuthority) ||
+		errors.As(err, &hostname) ||
+		errors.As(err, &invalid) ||
+		errors.As(err, &recordHeader)
+}
+
+// retryAfter returns the wait asked for by the Retry-After header of resp
+// the header holds either a number of seconds or a http date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// do sends req, retrying as the retry policy says
+// it returns the last response or error and the number of retries made
+func (f *Fetcher) do(ctx context.Context, req *http.Request) (*http.Response, int, error) {
+	retries := 0
+	for {
+		resp, err := f.client.Do(req.WithContext(ctx))
+
+		var wait time.Duration
+		switch {
+		case retries+1 >= f.retry.MaxAttempts || ctx.Err() != nil:
+			return resp, retries, err
+		case err != nil:
+			if !f.retry.retryError(err) {
+				return nil, retries, err
+			}
+			wait = f.retry.backoff(retries + 1)
+		case f.retry.retryStatus(resp.StatusCode):
+			wait = f.retry.backoff(retries + 1)
+			if after, ok := retryAfter(resp); ok {
+				if f.retry.MaxRetryAfter > 0 && after > f.retry.MaxRetryAfter {
+					return resp, retries, nil
+				}
+				if after > wait {
+					wait = after
+				}
+			}
+			// the connection is reused once the body is read
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+			resp.Body.Close()
+		default:
+			return resp, retries, nil
+		}
+
+		reason := err
+		if reason == nil {
+			reason = fmt.Errorf("status code : %d", resp.StatusCode)
+		}
+		retries++
+		log.Warn("retry  : ", retries, " : in ", wait.Round(time.Millisecond), " : ", req.URL, " : ", reason)
+		if err := f.backoff(ctx, req.URL.String(), wait); err != nil {
+			return nil, retries, err
+		}
+	}
+}
+
+// backoff waits before a retry of a request to url
+// a throttle in ctx postpones the other requests to the host as well
+func (f *Fetcher) backoff(ctx context.Context, url string, wait time.Duration) error {
+	if throttle := crawlers.ThrottleFrom(ctx); throttle != nil {
+		return throttle.Backoff(ctx, url, wait)
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,289 @@
+package robots
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxRobotsSize is the maximum number of bytes of robots.txt which are parsed
+const maxRobotsSize = 500 * 1024
+
+// rule defines a single Allow or Disallow line
+type rule struct {
+	allow   bool
+	pattern string
+}
+
+// group defines the rules which apply to a set of user agents
+type group struct {
+	agents     []string
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+// Rules defines a parsed robots.txt file
+type Rules struct {
+	groups []*group
+}
+
+// allowAll and disallowAll are used when robots.txt could not be read
+var (
+	allowAll    = &Rules{}
+	disallowAll = &Rules{groups: []*group{{agents: []string{"*"}, rules: []rule{{allow: false, pattern: "/"}}}}}
+)
+
+// Parse reads robots.txt content and returns its Rules
+func Parse(r io.Reader) *Rules {
+	rules := &Rules{}
+	var current *group
+	// a group is a set of user-agent lines followed by rule lines
+	// a user-agent line after a rule line starts a new group
+	acceptAgents := false
+
+	scanner := bufio.NewScanner(io.LimitReader(r, maxRobotsSize))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		val := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			if !acceptAgents {
+				current = &group{}
+				rules.groups = append(rules.groups, current)
+				acceptAgents = true
+			}
+			current.agents = append(current.agents, strings.ToLower(val))
+		case "allow", "disallow":
+			acceptAgents = false
+			if current == nil {
+				continue
+			}
+			// an empty disallow allows everything
+			if val == "" {
+				continue
+			}
+			current.rules = append(current.rules, rule{allow: key == "allow", pattern: val})
+		case "crawl-delay":
+			acceptAgents = false
+			if current == nil {
+				continue
+			}
+			seconds, err := strconv.ParseFloat(val, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+			current.crawlDelay = time.Duration(seconds * float64(time.Second))
+		}
+	}
+	return rules
+}
+
+// groupsFor returns the groups which apply to a user agent
+// groups naming the agent take precedence over the * groups
+func (r *Rules) groupsFor(userAgent string) []*group {
+	agent := strings.ToLower(userAgent)
+	var matched, wildcard []*group
+	for _, g := range r.groups {
+		for _, a := range g.agents {
+			if a == "*" {
+				wildcard = append(wildcard, g)
+				break
+			}
+			if a != "" && strings.Contains(agent, a) {
+				matched = append(matched, g)
+				break
+			}
+		}
+	}
+	if len(matched) > 0 {
+		return matched
+	}
+	return wildcard
+}
+
+// Allowed reports whether a user agent may fetch a path
+// the longest matching rule wins, allow wins a tie
+func (r *Rules) Allowed(userAgent, path string) bool {
+	if path == "/robots.txt" {
+		return true
+	}
+	matchLen := -1
+	allowed := true
+	for _, g := range r.groupsFor(userAgent) {
+		for _, rl := range g.rules {
+			if !match(rl.pattern, path) {
+				continue
+			}
+			if len(rl.pattern) > matchLen || (len(rl.pattern) == matchLen && rl.allow) {
+				matchLen = len(rl.pattern)
+				allowed = rl.allow
+			}
+		}
+	}
+	return allowed
+}
+
+// CrawlDelay returns the Crawl-delay for a user agent, 0 when none is set
+func (r *Rules) CrawlDelay(userAgent string) time.Duration {
+	var delay time.Duration
+	for _, g := range r.groupsFor(userAgent) {
+		if g.crawlDelay > delay {
+			delay = g.crawlDelay
+		}
+	}
+	return delay
+}
+
+// match reports whether path matches a robots.txt pattern
+// * matches any sequence of characters and a trailing $ anchors the pattern
+// to the end of the path, otherwise the pattern only has to match a prefix
+func match(pattern, path string) bool {
+	if strings.HasSuffix(pattern, "$") {
+		pattern = pattern[:len(pattern)-1]
+	} else {
+		pattern += "*"
+	}
+
+	// p, s walk pattern and path; star, mark remember the last * for backtracking
+	p, s, star, mark := 0, 0, -1, 0
+	for s < len(path) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, s
+			p++
+		case p < len(pattern) && pattern[p] == path[s]:
+			p++
+			s++
+		case star >= 0:
+			mark++
+			p, s = star+1, mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// entry defines the cached robots.txt of a host
+type entry struct {
+	// mu is held while robots.txt is fetched, rules is nil until it is
+	mu    sync.Mutex
+	rules *Rules
+}
+
+// Checker implements crawlers.RobotsChecker interface
+// Checker fetches robots.txt once per host and caches its rules
+type Checker struct {
+	userAgent string
+	client    *http.Client
+	mu        sync.Mutex
+	hosts     map[string]*entry
+}
+
+// NewChecker creates and returns a Checker
+// robots.txt is fetched with client, http.DefaultClient is used if client is nil
+func NewChecker(userAgent string, client *http.Client) *Checker {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Checker{
+		userAgent: userAgent,
+		client:    client,
+		hosts:     map[string]*entry{},
+	}
+}
+
+// Allowed reports whether robots.txt of the url's host allows fetching the url
+// cancelling ctx aborts fetching robots.txt, the url is then disallowed
+func (c *Checker) Allowed(ctx context.Context, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return true
+	}
+	return c.rules(ctx, u).Allowed(c.userAgent, u.RequestURI())
+}
+
+// CrawlDelay returns the Crawl-delay robots.txt of the url's host asks for
+func (c *Checker) CrawlDelay(ctx context.Context, rawURL string) time.Duration {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return 0
+	}
+	return c.rules(ctx, u).CrawlDelay(c.userAgent)
+}
+
+// rules returns the cached rules of the host of u, fetching robots.txt if needed
+// rules fetched with a cancelled ctx are not cached, the next call fetches them again
+func (c *Checker) rules(ctx context.Context, u *url.URL) *Rules {
+	key := strings.ToLower(u.Scheme + "://" + u.Host)
+
+	c.mu.Lock()
+	e, ok := c.hosts[key]
+	if !ok {
+		e = &entry{}
+		c.hosts[key] = e
+	}
+	c.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.rules != nil {
+		return e.rules
+	}
+	rules := c.fetch(ctx, key+"/robots.txt")
+	if ctx.Err() != nil {
+		return disallowAll
+	}
+	e.rules = rules
+	return rules
+}
+
+// fetch downloads and parses a robots.txt
+// a missing robots.txt (4xx) allows everything
+// an unreachable robots.txt (5xx, network error) disallows everything
+func (c *Checker) fetch(ctx context.Context, robotsURL string) *Rules {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return allowAll
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		log.Warn("robots : ", robotsURL, " : err : ", err)
+		return disallowAll
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		log.Debug("robots : fetched : ", robotsURL)
+		return Parse(resp.Body)
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		log.Debug("robots : not found : ", robotsURL)
+		return allowAll
+	default:
+		log.Warn("robots : ", robotsURL, " : status code : ", resp.StatusCode)
+		return disallowAll
+	}
+}
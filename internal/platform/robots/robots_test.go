@@ -0,0 +1,154 @@
+package robots_test
+
+import (
+	"context"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikhil-thomas/web-crawler/internal/platform/robots"
+)
+
+const robotsTxt = `# sample robots.txt
+User-agent: *
+Disallow: /private/
+Allow: /private/public.html
+Disallow: /*.pdf$
+Disallow: /search?*q=
+Crawl-delay: 2
+
+User-agent: special-bot
+User-agent: other-bot
+Disallow: /
+
+User-agent: web-crawler
+Disallow:
+Crawl-delay: 0.5
+`
+
+func TestRules(t *testing.T) {
+	rules := robots.Parse(strings.NewReader(robotsTxt))
+
+	tests := []struct {
+		agent    string
+		path     string
+		expected bool
+	}{
+		{"generic-bot", "/", true},
+		{"generic-bot", "/private/", false},
+		{"generic-bot", "/private/index.html", false},
+		{"generic-bot", "/private/public.html", true},
+		{"generic-bot", "/docs/manual.pdf", false},
+		{"generic-bot", "/docs/manual.pdf?download=1", true},
+		{"generic-bot", "/search?lang=en&q=go", false},
+		{"generic-bot", "/search", true},
+		{"generic-bot", "/robots.txt", true},
+		{"special-bot/2.1", "/", false},
+		{"Other-Bot", "/about.html", false},
+		{"web-crawler", "/private/", true},
+	}
+
+	t.Run("it should apply the rules of the matching group", func(t *testing.T) {
+		for _, test := range tests {
+			got := rules.Allowed(test.agent, test.path)
+			if test.expected != got {
+				t.Errorf("%s %s : expected %t, got %t", test.agent, test.path, test.expected, got)
+			}
+		}
+	})
+
+	t.Run("it should return crawl delay of the matching group", func(t *testing.T) {
+		expected := 2 * time.Second
+		got := rules.CrawlDelay("generic-bot")
+		if expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+
+		expected = 500 * time.Millisecond
+		got = rules.CrawlDelay("web-crawler")
+		if expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	})
+}
+
+func TestChecker(t *testing.T) {
+	requests := 0
+	r := nethttp.NewServeMux()
+	r.Handle("/robots.txt", nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		requests++
+		w.Write([]byte(robotsTxt))
+	}))
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	t.Run("it should check urls against robots.txt of the host", func(t *testing.T) {
+		checker := robots.NewChecker("generic-bot", nil)
+
+		if !checker.Allowed(context.Background(), server.URL+"/index.html") {
+			t.Errorf("expected %s to be allowed", server.URL+"/index.html")
+		}
+		if checker.Allowed(context.Background(), server.URL+"/private/index.html") {
+			t.Errorf("expected %s to be disallowed", server.URL+"/private/index.html")
+		}
+
+		expected := 2 * time.Second
+		got := checker.CrawlDelay(context.Background(), server.URL+"/index.html")
+		if expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+
+		if requests != 1 {
+			t.Errorf("expected robots.txt to be fetched once, got %d", requests)
+		}
+	})
+
+	t.Run("it should allow everything when robots.txt is missing", func(t *testing.T) {
+		server := httptest.NewServer(nethttp.NotFoundHandler())
+		defer server.Close()
+
+		checker := robots.NewChecker("generic-bot", nil)
+		if !checker.Allowed(context.Background(), server.URL+"/private/index.html") {
+			t.Errorf("expected %s to be allowed", server.URL+"/private/index.html")
+		}
+	})
+
+	t.Run("it should disallow everything when robots.txt is unavailable", func(t *testing.T) {
+		server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			w.WriteHeader(nethttp.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		checker := robots.NewChecker("generic-bot", nil)
+		if checker.Allowed(context.Background(), server.URL+"/index.html") {
+			t.Errorf("expected %s to be disallowed", server.URL+"/index.html")
+		}
+	})
+
+	t.Run("it should fetch robots.txt again after a cancelled fetch", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+			w.Write([]byte(robotsTxt))
+		}))
+		defer server.Close()
+
+		checker := robots.NewChecker("generic-bot", nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if checker.Allowed(ctx, server.URL+"/index.html") {
+			t.Errorf("expected %s to be disallowed while robots.txt is unknown", server.URL+"/index.html")
+		}
+
+		close(release)
+		if !checker.Allowed(context.Background(), server.URL+"/index.html") {
+			t.Errorf("expected %s to be allowed", server.URL+"/index.html")
+		}
+	})
+}
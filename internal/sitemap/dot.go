@@ -0,0 +1,62 @@
+package sitemap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteDOT writes the site graph in the Graphviz DOT language to w
+// nodes are labelled with their path, urls of other hosts with the full url
+func (sm *SiteMapManager) WriteDOT(w io.Writer, opts GraphOptions) error {
+	view := sm.graphView(opts)
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "digraph sitemap {")
+	fmt.Fprintln(bw, "  rankdir=LR;")
+	fmt.Fprintln(bw, "  node [shape=box, style=\"rounded,filled\", fillcolor=\"#ffffff\"];")
+
+	if opts.ClusterDepth > 0 {
+		for i, cluster := range view.clusters {
+			fmt.Fprintf(bw, "  subgraph \"cluster_%d\" {\n", i)
+			fmt.Fprintf(bw, "    label=%s;\n", dotQuote(cluster))
+			for _, node := range view.nodes {
+				if node.cluster == cluster {
+					writeDOTNode(bw, "    ", node)
+				}
+			}
+			fmt.Fprintln(bw, "  }")
+		}
+	} else {
+		for _, node := range view.nodes {
+			writeDOTNode(bw, "  ", node)
+		}
+	}
+
+	for _, edge := range view.edges {
+		fmt.Fprintf(bw, "  %s -> %s;\n", dotQuote(edge[0]), dotQuote(edge[1]))
+	}
+	fmt.Fprintln(bw, "}")
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("sitemap : dot : %s", err)
+	}
+	return nil
+}
+
+func writeDOTNode(w io.Writer, indent string, node *graphNode) {
+	attrs := []string{
+		"label=" + dotQuote(node.label),
+		"tooltip=" + dotQuote(node.url),
+	}
+	if node.color != "" {
+		attrs = append(attrs, "fillcolor="+dotQuote(node.color))
+	}
+	fmt.Fprintf(w, "%s%s [%s];\n", indent, dotQuote(node.url), strings.Join(attrs, ", "))
+}
+
+// dotQuote returns s as a quoted DOT identifier
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
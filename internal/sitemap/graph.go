@@ -0,0 +1,77 @@
+package sitemap
+
+import (
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+)
+
+// Edge defines a link from a crawled page to a url
+// Text is the anchor text of the link, Element the html element it came from
+type Edge struct {
+	Source  string
+	Target  string
+	Text    string
+	Element string
+}
+
+// Graph defines every link between the pages of a crawl
+// Sitemap keeps a url only under the first page it was found in,
+// Graph keeps all the links to it
+type Graph struct {
+	Edges []Edge
+	// referrers holds the indexes in Edges of the links to every url
+	referrers map[string][]int
+}
+
+// NewGraph creates and returns an empty Graph
+func NewGraph() *Graph {
+	return &Graph{referrers: map[string][]int{}}
+}
+
+// Add adds edges to the graph
+func (g *Graph) Add(edges ...Edge) {
+	if g.referrers == nil {
+		g.referrers = map[string][]int{}
+	}
+	for _, edge := range edges {
+		g.referrers[edge.Target] = append(g.referrers[edge.Target], len(g.Edges))
+		g.Edges = append(g.Edges, edge)
+	}
+}
+
+// AddLinks adds the links found in the page at source
+func (g *Graph) AddLinks(source string, links []crawlers.Link) {
+	for _, link := range links {
+		if link.URL == "" {
+			continue
+		}
+		g.Add(Edge{Source: source, Target: link.URL, Text: link.Text, Element: link.Element})
+	}
+}
+
+// Referrers returns the links to url in the order they were found
+func (g *Graph) Referrers(url string) []Edge {
+	var edges []Edge
+	for _, i := range g.referrers[url] {
+		edges = append(edges, g.Edges[i])
+	}
+	return edges
+}
+
+// Inbound returns the number of pages linking to url
+// a page linking to url several times is counted once
+func (g *Graph) Inbound(url string) int {
+	sources := map[string]bool{}
+	for _, i := range g.referrers[url] {
+		sources[g.Edges[i].Source] = true
+	}
+	return len(sources)
+}
+
+// InboundCounts returns the number of pages linking to every linked url
+func (g *Graph) InboundCounts() map[string]int {
+	counts := map[string]int{}
+	for url := range g.referrers {
+		counts[url] = g.Inbound(url)
+	}
+	return counts
+}
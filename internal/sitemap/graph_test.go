@@ -0,0 +1,52 @@
+package sitemap_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+	"github.com/nikhil-thomas/web-crawler/internal/sitemap"
+)
+
+func TestGraph(t *testing.T) {
+	graph := sitemap.NewGraph()
+	graph.AddLinks("https://example.com", []crawlers.Link{
+		{URL: "https://example.com/about.html", Element: "a", Text: "about"},
+		{URL: "https://example.com/contact.html", Element: "a", Text: "contact"},
+		{URL: "", Element: "a"},
+	})
+	graph.AddLinks("https://example.com/about.html", []crawlers.Link{
+		{URL: "https://example.com/contact.html", Element: "a", Text: "write to us"},
+		{URL: "https://example.com/contact.html", Element: "area", Text: "contact"},
+	})
+
+	t.Run("it should keep every link", func(t *testing.T) {
+		if len(graph.Edges) != 4 {
+			t.Errorf("expected 4 edges, got %d", len(graph.Edges))
+		}
+	})
+
+	t.Run("it should return all referrers of a url", func(t *testing.T) {
+		expected := []sitemap.Edge{
+			{Source: "https://example.com", Target: "https://example.com/contact.html", Text: "contact", Element: "a"},
+			{Source: "https://example.com/about.html", Target: "https://example.com/contact.html", Text: "write to us", Element: "a"},
+			{Source: "https://example.com/about.html", Target: "https://example.com/contact.html", Text: "contact", Element: "area"},
+		}
+		if got := graph.Referrers("https://example.com/contact.html"); !reflect.DeepEqual(expected, got) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+		if got := graph.Referrers("https://example.com/missing.html"); len(got) != 0 {
+			t.Errorf("expected no referrers, got %v", got)
+		}
+	})
+
+	t.Run("it should count the pages linking to a url", func(t *testing.T) {
+		expected := map[string]int{
+			"https://example.com/about.html":   1,
+			"https://example.com/contact.html": 2,
+		}
+		if got := graph.InboundCounts(); !reflect.DeepEqual(expected, got) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+}
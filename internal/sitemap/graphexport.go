@@ -0,0 +1,268 @@
+package sitemap
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// GraphEdges defines which edges a graph export holds
+type GraphEdges int
+
+const (
+	// TreeEdges are the parent/child links of the sitemap tree
+	TreeEdges GraphEdges = iota
+	// AllEdges are every link found in the crawled pages
+	AllEdges
+)
+
+// ParseGraphEdges returns the GraphEdges named tree or all
+func ParseGraphEdges(name string) (GraphEdges, error) {
+	switch strings.ToLower(name) {
+	case "", "tree":
+		return TreeEdges, nil
+	case "all":
+		return AllEdges, nil
+	}
+	return TreeEdges, fmt.Errorf("graph edges : %q : expected tree or all", name)
+}
+
+// GraphColor defines how the nodes of a graph export are colored
+type GraphColor int
+
+const (
+	// ColorNone leaves nodes uncolored
+	ColorNone GraphColor = iota
+	// ColorStatus colors nodes by the status code or the outcome of their fetch
+	ColorStatus
+	// ColorDepth colors nodes by their number of clicks from the root url
+	ColorDepth
+)
+
+// ParseGraphColor returns the GraphColor named none, status or depth
+func ParseGraphColor(name string) (GraphColor, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return ColorNone, nil
+	case "status":
+		return ColorStatus, nil
+	case "depth":
+		return ColorDepth, nil
+	}
+	return ColorNone, fmt.Errorf("graph color : %q : expected none, status or depth", name)
+}
+
+// GraphOptions defines how the site graph is exported
+type GraphOptions struct {
+	Edges GraphEdges
+	Color GraphColor
+	// ClusterDepth groups nodes by host and their first ClusterDepth path segments
+	// 0 means nodes are not grouped
+	ClusterDepth int
+	// MaxDepth leaves out nodes more than MaxDepth clicks away from the root url
+	// 0 means no limit
+	MaxDepth int
+}
+
+// depthColors are the colors of nodes by depth, deeper nodes take the last color
+var depthColors = []string{"#08519c", "#3182bd", "#6baed6", "#9ecae1", "#c6dbef", "#eff3ff"}
+
+const (
+	colorOK          = "#a1d99b"
+	colorRedirect    = "#9ecae1"
+	colorClientError = "#fdae6b"
+	colorServerError = "#fb6a4a"
+	colorFailed      = "#de2d26"
+	colorNotCrawled  = "#d9d9d9"
+)
+
+// graphNode defines a node of a graph export
+type graphNode struct {
+	url     string
+	label   string
+	depth   int
+	page    *Page
+	cluster string
+	color   string
+}
+
+// graphView defines the nodes and edges of a graph export
+type graphView struct {
+	nodes []*graphNode
+	index map[string]*graphNode
+	edges [][2]string
+	// clusters holds the cluster names in the order they are first found
+	clusters []string
+}
+
+// graphView returns the nodes and edges of the site graph selected by opts
+// nodes are in the order of the sitemap tree, urls found only in the link graph follow
+func (sm *SiteMapManager) graphView(opts GraphOptions) *graphView {
+	view := &graphView{index: map[string]*graphNode{}}
+
+	urls := sm.nodeOrder()
+	depths := sm.treeDepths()
+	if opts.Edges == AllEdges {
+		urls = sm.linkedOrder(urls, depths)
+	}
+
+	hosts := map[string]bool{}
+	for _, root := range sm.roots {
+		if u, err := url.Parse(root); err == nil {
+			hosts[u.Host] = true
+		}
+	}
+	seenClusters := map[string]bool{}
+	for _, u := range urls {
+		node := &graphNode{url: u, depth: depths[u], page: sm.Pages[u]}
+		if node.page != nil {
+			node.depth = node.page.Depth
+		}
+		if opts.MaxDepth > 0 && node.depth > opts.MaxDepth {
+			continue
+		}
+		node.label = graphLabel(u, hosts)
+		node.color = graphColor(node, opts.Color)
+		if opts.ClusterDepth > 0 {
+			node.cluster = graphCluster(u, opts.ClusterDepth)
+			if !seenClusters[node.cluster] {
+				seenClusters[node.cluster] = true
+				view.clusters = append(view.clusters, node.cluster)
+			}
+		}
+		view.nodes = append(view.nodes, node)
+		view.index[u] = node
+	}
+
+	seenEdges := map[[2]string]bool{}
+	addEdge := func(source, target string) {
+		edge := [2]string{source, target}
+		if view.index[source] == nil || view.index[target] == nil || seenEdges[edge] {
+			return
+		}
+		seenEdges[edge] = true
+		view.edges = append(view.edges, edge)
+	}
+	if opts.Edges == AllEdges {
+		for _, edge := range sm.Graph.Edges {
+			addEdge(edge.Source, edge.Target)
+		}
+	} else {
+		for _, node := range view.nodes {
+			for _, child := range sm.Sitemap[node.url] {
+				addEdge(node.url, child)
+			}
+		}
+	}
+	return view
+}
+
+// treeDepths returns the number of clicks from the root urls of every url along the sitemap tree
+// it is the depth of urls which were not crawled
+func (sm *SiteMapManager) treeDepths() map[string]int {
+	depths := map[string]int{}
+	queue := []string{}
+	for _, root := range sm.roots {
+		if _, ok := depths[root]; !ok {
+			depths[root] = 0
+			queue = append(queue, root)
+		}
+	}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		for _, child := range sm.Sitemap[parent] {
+			if _, ok := depths[child]; !ok {
+				depths[child] = depths[parent] + 1
+				queue = append(queue, child)
+			}
+		}
+	}
+	return depths
+}
+
+// linkedOrder appends to urls the urls found only in the link graph
+// their depth is one more than the depth of the page they were first found in
+func (sm *SiteMapManager) linkedOrder(urls []string, depths map[string]int) []string {
+	seen := map[string]bool{}
+	for _, u := range urls {
+		seen[u] = true
+	}
+	for _, edge := range sm.Graph.Edges {
+		if !seen[edge.Target] {
+			seen[edge.Target] = true
+			if _, ok := depths[edge.Target]; !ok {
+				depths[edge.Target] = depths[edge.Source] + 1
+			}
+			urls = append(urls, edge.Target)
+		}
+	}
+	return urls
+}
+
+// graphLabel returns the path of urls on the hosts of the root urls and the full url of others
+func graphLabel(rawURL string, hosts map[string]bool) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || !hosts[u.Host] {
+		return rawURL
+	}
+	label := u.EscapedPath()
+	if label == "" {
+		label = "/"
+	}
+	if u.RawQuery != "" {
+		label += "?" + u.RawQuery
+	}
+	return label
+}
+
+// graphCluster returns the host and the first depth path segments of a url, eg: example.com/blog
+func graphCluster(rawURL string, depth int) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	segments := strings.Split(strings.Trim(u.EscapedPath(), "/"), "/")
+	// the last segment is the page itself
+	if len(segments) > 0 && !strings.HasSuffix(u.EscapedPath(), "/") {
+		segments = segments[:len(segments)-1]
+	}
+	if len(segments) > depth {
+		segments = segments[:depth]
+	}
+	cluster := u.Host
+	for _, segment := range segments {
+		if segment != "" {
+			cluster += "/" + segment
+		}
+	}
+	return cluster
+}
+
+// graphColor returns the fill color of a node, empty when nodes are not colored
+func graphColor(node *graphNode, color GraphColor) string {
+	switch color {
+	case ColorDepth:
+		if node.depth < len(depthColors) {
+			return depthColors[node.depth]
+		}
+		return depthColors[len(depthColors)-1]
+	case ColorStatus:
+		page := node.page
+		switch {
+		case page == nil || page.StatusCode == 0 && !page.Outcome.Failed():
+			return colorNotCrawled
+		case page.StatusCode >= 500:
+			return colorServerError
+		case page.StatusCode >= 400:
+			return colorClientError
+		case page.StatusCode >= 300, page.FinalURL != "" && page.FinalURL != page.URL:
+			return colorRedirect
+		case page.Outcome.Failed():
+			return colorFailed
+		default:
+			return colorOK
+		}
+	}
+	return ""
+}
@@ -0,0 +1,214 @@
+package sitemap_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+	"github.com/nikhil-thomas/web-crawler/internal/sitemap"
+)
+
+func graphSiteManager() *sitemap.SiteMapManager {
+	result := sitemap.NewResult()
+	result.Roots = []string{"https://example.com"}
+	result.Sitemap = map[string]sitemap.Children{
+		"https://example.com":            sitemap.Children{"https://example.com/blog/", "https://example.com/about.html"},
+		"https://example.com/blog/":      sitemap.Children{"https://example.com/blog/post.html"},
+		"https://example.com/about.html": sitemap.Children{},
+	}
+	result.AddPage("https://example.com", 0, &crawlers.FetchResult{StatusCode: 200}, nil)
+	result.AddPage("https://example.com/blog/", 1, &crawlers.FetchResult{StatusCode: 200}, nil)
+	result.AddPage("https://example.com/about.html", 1, &crawlers.FetchResult{StatusCode: 500},
+		&crawlers.StatusError{URL: "https://example.com/about.html", StatusCode: 500})
+	result.Graph.AddLinks("https://example.com", []crawlers.Link{
+		{URL: "https://example.com/blog/", Element: "a"},
+		{URL: "https://example.com/about.html", Element: "a"},
+	})
+	result.Graph.AddLinks("https://example.com/blog/", []crawlers.Link{
+		{URL: "https://example.com/blog/post.html", Element: "a"},
+		{URL: "https://example.com/about.html", Element: "a"},
+		{URL: "https://golang.org/", Element: "a"},
+	})
+	stmpMng := sitemap.NewSiteManager("https://example.com", &resultCrawler{result: result})
+	stmpMng.Crawl(context.Background())
+	return stmpMng
+}
+
+// failOnceWriter fails the write which goes past n bytes, the writes before and after succeed
+type failOnceWriter struct {
+	n      int
+	failed bool
+}
+
+func (fw *failOnceWriter) Write(p []byte) (int, error) {
+	if !fw.failed && len(p) > fw.n {
+		fw.failed = true
+		return fw.n, errors.New("disk full")
+	}
+	fw.n -= len(p)
+	return len(p), nil
+}
+
+func TestWriteDOT(t *testing.T) {
+	stmpMng := graphSiteManager()
+
+	t.Run("it should write the sitemap tree", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := stmpMng.WriteDOT(&buf, sitemap.GraphOptions{}); err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+
+		expected := `digraph sitemap {
+  rankdir=LR;
+  node [shape=box, style="rounded,filled", fillcolor="#ffffff"];
+  "https://example.com" [label="/", tooltip="https://example.com"];
+  "https://example.com/blog/" [label="/blog/", tooltip="https://example.com/blog/"];
+  "https://example.com/blog/post.html" [label="/blog/post.html", tooltip="https://example.com/blog/post.html"];
+  "https://example.com/about.html" [label="/about.html", tooltip="https://example.com/about.html"];
+  "https://example.com" -> "https://example.com/blog/";
+  "https://example.com" -> "https://example.com/about.html";
+  "https://example.com/blog/" -> "https://example.com/blog/post.html";
+}
+`
+		if got := buf.String(); expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	})
+
+	t.Run("it should cluster nodes by path and color them by status", func(t *testing.T) {
+		var buf bytes.Buffer
+		stmpMng.WriteDOT(&buf, sitemap.GraphOptions{ClusterDepth: 1, Color: sitemap.ColorStatus})
+		got := buf.String()
+
+		for _, expected := range []string{
+			"  subgraph \"cluster_0\" {\n    label=\"example.com\";\n    \"https://example.com\" [label=\"/\", tooltip=\"https://example.com\", fillcolor=\"#a1d99b\"];\n",
+			"  subgraph \"cluster_1\" {\n    label=\"example.com/blog\";\n    \"https://example.com/blog/\"",
+			`"https://example.com/about.html" [label="/about.html", tooltip="https://example.com/about.html", fillcolor="#fb6a4a"];`,
+			`"https://example.com/blog/post.html" [label="/blog/post.html", tooltip="https://example.com/blog/post.html", fillcolor="#d9d9d9"];`,
+		} {
+			if !strings.Contains(got, expected) {
+				t.Errorf("expected %s in %s", expected, got)
+			}
+		}
+	})
+
+	t.Run("it should write every link up to the maximum depth", func(t *testing.T) {
+		var buf bytes.Buffer
+		stmpMng.WriteDOT(&buf, sitemap.GraphOptions{Edges: sitemap.AllEdges, MaxDepth: 1})
+		got := buf.String()
+
+		expected := `  "https://example.com" -> "https://example.com/blog/";
+  "https://example.com" -> "https://example.com/about.html";
+  "https://example.com/blog/" -> "https://example.com/about.html";
+}
+`
+		if !strings.HasSuffix(got, expected) {
+			t.Errorf("expected %s at the end of %s", expected, got)
+		}
+		if strings.Contains(got, "post.html") || strings.Contains(got, "golang.org") {
+			t.Errorf("expected no url deeper than 1, got %s", got)
+		}
+
+		buf.Reset()
+		stmpMng.WriteDOT(&buf, sitemap.GraphOptions{Edges: sitemap.AllEdges})
+		if expected := `"https://golang.org/" [label="https://golang.org/", tooltip="https://golang.org/"];`; !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %s in %s", expected, buf.String())
+		}
+	})
+
+	t.Run("it should reject unknown edges and colors", func(t *testing.T) {
+		if _, err := sitemap.ParseGraphEdges("some"); err == nil {
+			t.Error("error expected, got nil")
+		}
+		if _, err := sitemap.ParseGraphColor("rainbow"); err == nil {
+			t.Error("error expected, got nil")
+		}
+	})
+}
+
+func TestWriteGraphML(t *testing.T) {
+	stmpMng := graphSiteManager()
+
+	var buf bytes.Buffer
+	if err := stmpMng.WriteGraphML(&buf, sitemap.GraphOptions{Edges: sitemap.AllEdges, Color: sitemap.ColorDepth}); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	var doc struct {
+		Keys []struct {
+			ID   string `xml:"id,attr"`
+			Name string `xml:"attr.name,attr"`
+		} `xml:"key"`
+		Graph struct {
+			EdgeDefault string `xml:"edgedefault,attr"`
+			Nodes       []struct {
+				ID   string `xml:"id,attr"`
+				Data []struct {
+					Key   string `xml:"key,attr"`
+					Value string `xml:",chardata"`
+				} `xml:"data"`
+			} `xml:"node"`
+			Edges []struct {
+				Source string `xml:"source,attr"`
+				Target string `xml:"target,attr"`
+			} `xml:"edge"`
+		} `xml:"graph"`
+	}
+
+	t.Run("it should write valid graphml", func(t *testing.T) {
+		if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+			t.Fatalf("expected graphml, got %s", err)
+		}
+		if doc.Graph.EdgeDefault != "directed" {
+			t.Errorf("expected directed graph, got %s", doc.Graph.EdgeDefault)
+		}
+		if len(doc.Graph.Nodes) != 5 || len(doc.Graph.Edges) != 5 {
+			t.Errorf("expected 5 nodes and 5 edges, got %d and %d", len(doc.Graph.Nodes), len(doc.Graph.Edges))
+		}
+	})
+
+	t.Run("it should write node attributes", func(t *testing.T) {
+		names := map[string]string{}
+		for _, key := range doc.Keys {
+			names[key.ID] = key.Name
+		}
+		var about map[string]string
+		for _, node := range doc.Graph.Nodes {
+			attrs := map[string]string{}
+			for _, data := range node.Data {
+				attrs[names[data.Key]] = data.Value
+			}
+			if attrs["url"] == "https://example.com/about.html" {
+				about = attrs
+			}
+		}
+		expected := map[string]string{
+			"url":     "https://example.com/about.html",
+			"label":   "/about.html",
+			"depth":   "1",
+			"status":  "500",
+			"outcome": "http-error",
+			"color":   "#3182bd",
+		}
+		if len(about) != len(expected) {
+			t.Fatalf("expected %v, got %v", expected, about)
+		}
+		for name, value := range expected {
+			if about[name] != value {
+				t.Errorf("expected %s %s, got %s", name, value, about[name])
+			}
+		}
+	})
+	t.Run("it should report every failed write", func(t *testing.T) {
+		opts := sitemap.GraphOptions{Edges: sitemap.AllEdges, Color: sitemap.ColorDepth}
+		for n := 0; n < buf.Len(); n++ {
+			if err := stmpMng.WriteGraphML(&failOnceWriter{n: n}, opts); err == nil {
+				t.Fatalf("expected an error when writing fails after %d bytes, got nil", n)
+			}
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// graphMLKeys are the attributes of the nodes of a GraphML export
+var graphMLKeys = []struct {
+	id, name, kind string
+}{
+	{"d0", "url", "string"},
+	{"d1", "label", "string"},
+	{"d2", "depth", "int"},
+	{"d3", "status", "int"},
+	{"d4", "outcome", "string"},
+	{"d5", "cluster", "string"},
+	{"d6", "color", "string"},
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	XMLName xml.Name      `xml:"node"`
+	ID      string        `xml:"id,attr"`
+	Data    []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	XMLName xml.Name `xml:"edge"`
+	ID      string   `xml:"id,attr"`
+	Source  string   `xml:"source,attr"`
+	Target  string   `xml:"target,attr"`
+}
+
+// WriteGraphML writes the site graph in GraphML to w, for Gephi and yEd
+// the url, label, depth, status, outcome, cluster and color of nodes are node attributes
+func (sm *SiteMapManager) WriteGraphML(w io.Writer, opts GraphOptions) error {
+	view := sm.graphView(opts)
+	ids := map[string]string{}
+
+	if _, err := io.WriteString(w, xml.Header+
+		`<graphml xmlns="http://graphml.graphdrawing.org/xmlns"`+
+		` xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"`+
+		` xsi:schemaLocation="http://graphml.graphdrawing.org/xmlns http://graphml.graphdrawing.org/xmlns/1.0/graphml.xsd">`+"\n"); err != nil {
+		return fmt.Errorf("sitemap : graphml : %s", err)
+	}
+	for _, key := range graphMLKeys {
+		if _, err := fmt.Fprintf(w, "  <key id=%q for=\"node\" attr.name=%q attr.type=%q/>\n", key.id, key.name, key.kind); err != nil {
+			return fmt.Errorf("sitemap : graphml : %s", err)
+		}
+	}
+	if _, err := fmt.Fprintln(w, `  <graph id="sitemap" edgedefault="directed">`); err != nil {
+		return fmt.Errorf("sitemap : graphml : %s", err)
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("    ", "  ")
+	for i, node := range view.nodes {
+		ids[node.url] = "n" + strconv.Itoa(i)
+		gn := graphMLNode{ID: ids[node.url]}
+		values := []string{node.url, node.label, strconv.Itoa(node.depth), "", "", node.cluster, node.color}
+		if node.page != nil {
+			if node.page.StatusCode != 0 {
+				values[3] = strconv.Itoa(node.page.StatusCode)
+			}
+			values[4] = string(node.page.Outcome)
+		}
+		for j, value := range values {
+			if value != "" {
+				gn.Data = append(gn.Data, graphMLData{Key: graphMLKeys[j].id, Value: value})
+			}
+		}
+		if err := enc.Encode(gn); err != nil {
+			return fmt.Errorf("sitemap : graphml : %s", err)
+		}
+	}
+	for i, edge := range view.edges {
+		ge := graphMLEdge{ID: "e" + strconv.Itoa(i), Source: ids[edge[0]], Target: ids[edge[1]]}
+		if err := enc.Encode(ge); err != nil {
+			return fmt.Errorf("sitemap : graphml : %s", err)
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		return fmt.Errorf("sitemap : graphml : %s", err)
+	}
+
+	if _, err := io.WriteString(w, "\n  </graph>\n</graphml>\n"); err != nil {
+		return fmt.Errorf("sitemap : graphml : %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package sitemap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+)
+
+// jsonSitemap is the json form of a sitemap
+// nodes are every url of the sitemap, edges the parent/child links of the tree
+// and links every link found in the crawled pages
+type jsonSitemap struct {
+	Roots []string   `json:"roots"`
+	Nodes []jsonNode `json:"nodes"`
+	Edges []jsonEdge `json:"edges"`
+	Links []jsonLink `json:"links"`
+}
+
+// jsonNode is a url of the sitemap, Page is nil for urls which were not crawled
+type jsonNode struct {
+	URL  string    `json:"url"`
+	Page *jsonPage `json:"page,omitempty"`
+}
+
+// jsonPage is the metadata of a crawled url
+type jsonPage struct {
+	Depth          int         `json:"depth"`
+	Outcome        string      `json:"outcome"`
+	Error          string      `json:"error,omitempty"`
+	StatusCode     int         `json:"status_code,omitempty"`
+	FinalURL       string      `json:"final_url,omitempty"`
+	ContentType    string      `json:"content_type,omitempty"`
+	ContentLength  int64       `json:"content_length,omitempty"`
+	ResponseTimeMS float64     `json:"response_time_ms,omitempty"`
+	Header         http.Header `json:"header,omitempty"`
+	NoIndex        bool        `json:"noindex,omitempty"`
+	NoFollow       bool        `json:"nofollow,omitempty"`
+	Title          string      `json:"title,omitempty"`
+	Canonical      string      `json:"canonical,omitempty"`
+	Retries        int         `json:"retries,omitempty"`
+}
+
+// jsonEdge is a parent/child link of the sitemap tree
+type jsonEdge struct {
+	Parent string `json:"parent"`
+	Child  string `json:"child"`
+}
+
+// jsonLink is a link found in a crawled page
+type jsonLink struct {
+	Source  string `json:"source"`
+	Target  string `json:"target"`
+	Text    string `json:"text,omitempty"`
+	Element string `json:"element,omitempty"`
+}
+
+// WriteJSON writes the sitemap, the metadata of the crawled pages and the links between them as json to w
+func (sm *SiteMapManager) WriteJSON(w io.Writer) error {
+	js := jsonSitemap{
+		Roots: sm.roots,
+		Nodes: []jsonNode{},
+		Edges: []jsonEdge{},
+		Links: []jsonLink{},
+	}
+	for _, url := range sm.nodeOrder() {
+		node := jsonNode{URL: url}
+		if page, ok := sm.Pages[url]; ok {
+			node.Page = newJSONPage(page)
+		}
+		js.Nodes = append(js.Nodes, node)
+		for _, child := range sm.Sitemap[url] {
+			js.Edges = append(js.Edges, jsonEdge{Parent: url, Child: child})
+		}
+	}
+	for _, edge := range sm.Graph.Edges {
+		js.Links = append(js.Links, jsonLink(edge))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(js); err != nil {
+		return fmt.Errorf("sitemap : json : %s", err)
+	}
+	return nil
+}
+
+// nodeOrder returns the urls of the sitemap tree in the order they are printed,
+// followed by the urls out of the tree sorted
+func (sm *SiteMapManager) nodeOrder() []string {
+	urls := sm.treeOrder()
+	seen := map[string]bool{}
+	for _, url := range urls {
+		seen[url] = true
+	}
+	var rest []string
+	for url := range sm.Sitemap {
+		if !seen[url] {
+			seen[url] = true
+			rest = append(rest, url)
+		}
+	}
+	for url := range sm.Pages {
+		if !seen[url] {
+			seen[url] = true
+			rest = append(rest, url)
+		}
+	}
+	sort.Strings(rest)
+	return append(urls, rest...)
+}
+
+func newJSONPage(page *Page) *jsonPage {
+	jp := &jsonPage{
+		Depth:          page.Depth,
+		Outcome:        string(page.Outcome),
+		StatusCode:     page.StatusCode,
+		FinalURL:       page.FinalURL,
+		ContentType:    page.ContentType,
+		ContentLength:  page.ContentLength,
+		ResponseTimeMS: float64(page.ResponseTime) / float64(time.Millisecond),
+		Header:         page.Header,
+		NoIndex:        page.NoIndex,
+		NoFollow:       page.NoFollow,
+		Title:          page.Title,
+		Canonical:      page.Canonical,
+		Retries:        page.Retries,
+	}
+	if page.Err != nil {
+		jp.Error = page.Err.Error()
+	}
+	return jp
+}
+
+func (jp *jsonPage) page(url string) *Page {
+	page := &Page{
+		FetchResult: crawlers.FetchResult{
+			URL:           url,
+			FinalURL:      jp.FinalURL,
+			StatusCode:    jp.StatusCode,
+			ContentType:   jp.ContentType,
+			ContentLength: jp.ContentLength,
+			ResponseTime:  time.Duration(jp.ResponseTimeMS * float64(time.Millisecond)),
+			Header:        jp.Header,
+			NoIndex:       jp.NoIndex,
+			NoFollow:      jp.NoFollow,
+			Title:         jp.Title,
+			Canonical:     jp.Canonical,
+			Retries:       jp.Retries,
+		},
+		Depth:   jp.Depth,
+		Outcome: crawlers.Outcome(jp.Outcome),
+	}
+	if jp.Error != "" {
+		page.Err = crawlers.RestoreError(url, page.Outcome, jp.StatusCode, jp.Error)
+	}
+	return page
+}
+
+// ReadJSON rebuilds a SiteMapManager from the json written by WriteJSON
+// the sitemap can be printed and exported again, Crawl keeps the loaded pages
+func ReadJSON(r io.Reader) (*SiteMapManager, error) {
+	var js jsonSitemap
+	if err := json.NewDecoder(r).Decode(&js); err != nil {
+		return nil, fmt.Errorf("sitemap : json : %s", err)
+	}
+
+	result := NewResult()
+	result.Roots = js.Roots
+	for _, node := range js.Nodes {
+		result.Sitemap[node.URL] = Children{}
+		if node.Page != nil {
+			result.Pages[node.URL] = node.Page.page(node.URL)
+		}
+	}
+	for _, edge := range js.Edges {
+		result.Sitemap[edge.Parent] = append(result.Sitemap[edge.Parent], edge.Child)
+		if _, ok := result.Sitemap[edge.Child]; !ok {
+			result.Sitemap[edge.Child] = Children{}
+		}
+	}
+	for _, link := range js.Links {
+		result.Graph.Add(Edge(link))
+	}
+
+	sm := NewSeededSiteManager(js.Roots, loadedCrawler{result: result})
+	sm.Sitemap = result.Sitemap
+	sm.Pages = result.Pages
+	sm.Graph = result.Graph
+	return sm, nil
+}
+
+// loadedCrawler implements Crawler for a sitemap read from json
+type loadedCrawler struct {
+	result *Result
+}
+
+// Crawl returns the loaded result without fetching anything
+func (lc loadedCrawler) Crawl(ctx context.Context, urls ...string) (*Result, error) {
+	return lc.result, nil
+}
@@ -0,0 +1,114 @@
+package sitemap_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+	"github.com/nikhil-thomas/web-crawler/internal/sitemap"
+)
+
+func TestJSON(t *testing.T) {
+	stmpMng := xmlSiteManager()
+	stmpMng.Crawl(context.Background())
+	stmpMng.Pages["https://example.com/blog/"].ResponseTime = 120 * time.Millisecond
+	stmpMng.Graph.AddLinks("https://example.com", []crawlers.Link{
+		{URL: "https://example.com/blog/", Element: "a", Text: "blog"},
+		{URL: "https://example.com/logo.png", Element: "img", Text: "logo"},
+	})
+	stmpMng.Graph.AddLinks("https://example.com/blog/", []crawlers.Link{
+		{URL: "https://example.com/blog/post.html", Element: "a", Text: "first post"},
+		{URL: "https://example.com", Element: "a", Text: "home"},
+	})
+
+	var buf bytes.Buffer
+	if err := stmpMng.WriteJSON(&buf); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	t.Run("it should write roots, nodes with page metadata, edges and links", func(t *testing.T) {
+		var doc struct {
+			Roots []string
+			Nodes []struct {
+				URL  string
+				Page map[string]interface{}
+			}
+			Edges []map[string]string
+			Links []map[string]string
+		}
+		if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+			t.Fatalf("expected json, got %s", err)
+		}
+
+		if !reflect.DeepEqual([]string{"https://example.com"}, doc.Roots) {
+			t.Errorf("expected roots %v, got %v", []string{"https://example.com"}, doc.Roots)
+		}
+		if len(doc.Nodes) != 9 || doc.Nodes[0].URL != "https://example.com" {
+			t.Errorf("expected 9 nodes starting from root url, got %v", doc.Nodes)
+		}
+		for _, node := range doc.Nodes {
+			switch node.URL {
+			case "https://example.com/blog/":
+				if node.Page["status_code"] != 200.0 || node.Page["outcome"] != "ok" || node.Page["response_time_ms"] != 120.0 {
+					t.Errorf("expected page metadata, got %v", node.Page)
+				}
+			case "https://example.com/missing.html":
+				if node.Page["status_code"] != 404.0 || node.Page["outcome"] != "http-error" || node.Page["error"] == nil {
+					t.Errorf("expected failed page, got %v", node.Page)
+				}
+			case "https://example.com/logo.png":
+				if node.Page != nil {
+					t.Errorf("expected no page for a url which was not crawled, got %v", node.Page)
+				}
+			}
+		}
+		edge := map[string]string{"parent": "https://example.com/blog/", "child": "https://example.com/blog/post.html"}
+		if len(doc.Edges) != 8 || !reflect.DeepEqual(edge, doc.Edges[7]) {
+			t.Errorf("expected 8 edges ending with %v, got %v", edge, doc.Edges)
+		}
+		link := map[string]string{"source": "https://example.com/blog/", "target": "https://example.com", "text": "home", "element": "a"}
+		if len(doc.Links) != 4 || !reflect.DeepEqual(link, doc.Links[3]) {
+			t.Errorf("expected 4 links ending with %v, got %v", link, doc.Links)
+		}
+	})
+
+	t.Run("it should rebuild the sitemap from json", func(t *testing.T) {
+		loaded, err := sitemap.ReadJSON(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		loaded.Crawl(context.Background())
+
+		var expected, got bytes.Buffer
+		stmpMng.FPrintMap(&expected)
+		loaded.FPrintMap(&got)
+		if expected.String() != got.String() {
+			t.Errorf("expected %s, got %s", expected.String(), got.String())
+		}
+		if !reflect.DeepEqual(stmpMng.Pages, loaded.Pages) {
+			t.Errorf("expected pages %v, got %v", stmpMng.Pages, loaded.Pages)
+		}
+		if !reflect.DeepEqual(stmpMng.Graph.Edges, loaded.Graph.Edges) {
+			t.Errorf("expected links %v, got %v", stmpMng.Graph.Edges, loaded.Graph.Edges)
+		}
+		if n := loaded.Graph.Inbound("https://example.com"); n != 1 {
+			t.Errorf("expected 1 page linking to root url, got %d", n)
+		}
+
+		var statusErr *crawlers.StatusError
+		if err := loaded.Pages["https://example.com/missing.html"].Err; !errors.As(err, &statusErr) || statusErr.StatusCode != 404 {
+			t.Errorf("expected status error with code 404, got %v", err)
+		}
+	})
+
+	t.Run("it should reject invalid json", func(t *testing.T) {
+		if _, err := sitemap.ReadJSON(bytes.NewReader([]byte("::::: Site Map"))); err == nil {
+			t.Error("error expected, got nil")
+		}
+	})
+}
@@ -0,0 +1,352 @@
+package sitemap
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+)
+
+// reportNode is a url of the html report
+// Children are the indexes of the children of the url in the sitemap tree,
+// In and Out the indexes of the pages linking to it and of the urls it links to
+// HTTP is set for http and https urls, the only urls the report links to
+type reportNode struct {
+	URL      string `json:"url"`
+	HTTP     bool   `json:"http,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Outcome  string `json:"outcome,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Depth    int    `json:"depth"`
+	Crawled  bool   `json:"crawled"`
+	NoIndex  bool   `json:"noindex,omitempty"`
+	Children []int  `json:"children,omitempty"`
+	In       []int  `json:"in,omitempty"`
+	Out      []int  `json:"out,omitempty"`
+}
+
+// reportData is the data the html report is rendered from
+type reportData struct {
+	Roots []int        `json:"roots"`
+	Nodes []reportNode `json:"nodes"`
+}
+
+// WriteHTML writes a self-contained html report of the sitemap to w
+// the report holds a collapsible sitemap tree, a search over urls, the details
+// of every page and charts of status codes and depths
+// it loads nothing from the network
+func (sm *SiteMapManager) WriteHTML(w io.Writer) error {
+	depths := sm.treeDepths()
+	urls := sm.linkedOrder(sm.nodeOrder(), depths)
+	index := map[string]int{}
+	for i, url := range urls {
+		index[url] = i
+	}
+
+	data := reportData{Roots: []int{}, Nodes: make([]reportNode, len(urls))}
+	for _, root := range sm.roots {
+		if i, ok := index[root]; ok {
+			data.Roots = append(data.Roots, i)
+		}
+	}
+	for i, url := range urls {
+		node := &data.Nodes[i]
+		node.URL = url
+		node.HTTP = crawlers.IsHTTP(url)
+		node.Depth = depths[url]
+		if page, ok := sm.Pages[url]; ok {
+			node.Crawled = true
+			node.Depth = page.Depth
+			node.Title = page.Title
+			node.Status = page.StatusCode
+			node.Outcome = string(page.Outcome)
+			node.NoIndex = page.NoIndex
+			if page.Err != nil {
+				node.Error = page.Err.Error()
+			}
+		}
+		for _, child := range sm.Sitemap[url] {
+			node.Children = append(node.Children, index[child])
+		}
+	}
+
+	linked := map[[2]int]bool{}
+	for _, edge := range sm.Graph.Edges {
+		source, ok := index[edge.Source]
+		if !ok {
+			continue
+		}
+		target := index[edge.Target]
+		if linked[[2]int{source, target}] {
+			continue
+		}
+		linked[[2]int{source, target}] = true
+		data.Nodes[source].Out = append(data.Nodes[source].Out, target)
+		data.Nodes[target].In = append(data.Nodes[target].In, source)
+	}
+
+	if err := reportTemplate.Execute(w, data); err != nil {
+		return fmt.Errorf("sitemap : html : %s", err)
+	}
+	return nil
+}
+
+// reportTemplate is the html report, the data is embedded as json
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1.0">
+<title>Site Map Report</title>
+<style>
+  body { margin: 0; font: 14px/1.4 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #222; }
+  header { padding: 12px 20px; background: #24292e; color: #fff; }
+  header h1 { margin: 0; font-size: 18px; }
+  header p { margin: 4px 0 0; color: #ccc; }
+  .charts { display: flex; flex-wrap: wrap; gap: 20px; padding: 12px 20px; border-bottom: 1px solid #ddd; }
+  .chart { flex: 1 1 300px; }
+  .chart h2, .panel h2 { font-size: 14px; margin: 0 0 8px; }
+  .bar { display: flex; align-items: center; margin: 2px 0; }
+  .bar .name { width: 140px; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+  .bar .fill { height: 14px; background: #6baed6; margin-right: 6px; min-width: 1px; }
+  .bar .fill.s2 { background: #a1d99b; } .bar .fill.s3 { background: #9ecae1; }
+  .bar .fill.s4 { background: #fdae6b; } .bar .fill.s5 { background: #fb6a4a; }
+  .bar .fill.failed { background: #de2d26; } .bar .fill.none { background: #d9d9d9; }
+  main { display: flex; align-items: flex-start; }
+  .panel { padding: 12px 20px; box-sizing: border-box; }
+  #tree-panel { flex: 3; min-width: 0; border-right: 1px solid #ddd; }
+  #details { flex: 2; min-width: 0; position: sticky; top: 0; max-height: 100vh; overflow: auto; }
+  #search { width: 100%; box-sizing: border-box; padding: 6px 8px; margin-bottom: 8px; font-size: 14px; }
+  ul { list-style: none; margin: 0; padding-left: 18px; }
+  #tree > ul, #results > ul { padding-left: 0; }
+  details > summary { cursor: pointer; }
+  .leaf { padding-left: 14px; }
+  a.node { color: #0366d6; text-decoration: none; word-break: break-all; }
+  a.node:hover, a.node.selected { text-decoration: underline; }
+  a.node.selected { font-weight: bold; }
+  .badge { display: inline-block; padding: 0 5px; margin-left: 6px; border-radius: 3px; font-size: 11px; background: #eee; }
+  .badge.s4, .badge.s5, .badge.failed { background: #fdd; }
+  table { border-collapse: collapse; width: 100%; }
+  th, td { text-align: left; vertical-align: top; padding: 3px 6px; border-bottom: 1px solid #eee; word-break: break-all; }
+  th { width: 90px; color: #555; }
+  .muted { color: #888; }
+</style>
+</head>
+<body>
+<header>
+  <h1>Site Map Report</h1>
+  <p id="summary"></p>
+</header>
+<section class="charts">
+  <div class="chart"><h2>Status codes</h2><div id="status-chart"></div></div>
+  <div class="chart"><h2>Depth</h2><div id="depth-chart"></div></div>
+</section>
+<main>
+  <section id="tree-panel" class="panel">
+    <input id="search" type="search" placeholder="Search urls and titles" autocomplete="off">
+    <div id="results" hidden></div>
+    <div id="tree"></div>
+  </section>
+  <section id="details" class="panel">
+    <h2>Page details</h2>
+    <p class="muted">Select a url to see its details.</p>
+  </section>
+</main>
+<script>
+(function () {
+  var data = {{.}};
+  var nodes = data.nodes;
+  var selected = null;
+
+  function el(tag, attrs, text) {
+    var e = document.createElement(tag);
+    for (var k in attrs || {}) { e.setAttribute(k, attrs[k]); }
+    if (text !== undefined) { e.textContent = text; }
+    return e;
+  }
+
+  function statusClass(n) {
+    if (!n.crawled || (!n.status && (n.outcome === "robots" || n.outcome === "not-html"))) { return "none"; }
+    if (n.status) { return "s" + String(n.status).charAt(0); }
+    return n.outcome === "ok" ? "s2" : "failed";
+  }
+
+  function statusName(n) {
+    if (!n.crawled) { return "not crawled"; }
+    if (n.status) { return String(n.status); }
+    return n.outcome;
+  }
+
+  // only http and https urls are opened, other urls are shown as text
+  function pageLink(n) {
+    if (!n.http) { return n.url; }
+    return el("a", {href: n.url, target: "_blank", rel: "noopener"}, n.url);
+  }
+
+  // link selects a node of the report, it never navigates to the url
+  function link(i) {
+    var a = el("a", {href: "#", "class": "node", "data-i": i}, nodes[i].url);
+    a.addEventListener("click", function (e) { e.preventDefault(); show(i); });
+    var badge = el("span", {"class": "badge " + statusClass(nodes[i])}, statusName(nodes[i]));
+    var span = el("span");
+    span.appendChild(a);
+    span.appendChild(badge);
+    return span;
+  }
+
+  // children are rendered the first time a node is expanded
+  function treeItem(i, seen) {
+    var n = nodes[i];
+    var li = el("li");
+    var children = (n.children || []).filter(function (c) { return !seen[c]; });
+    if (children.length === 0) {
+      var leaf = el("div", {"class": "leaf"});
+      leaf.appendChild(link(i));
+      li.appendChild(leaf);
+      return li;
+    }
+    children.forEach(function (c) { seen[c] = true; });
+    var details = el("details");
+    var summary = el("summary");
+    summary.appendChild(link(i));
+    summary.appendChild(el("span", {"class": "muted"}, " (" + children.length + ")"));
+    details.appendChild(summary);
+    var rendered = false;
+    details.addEventListener("toggle", function () {
+      if (!details.open || rendered) { return; }
+      rendered = true;
+      var ul = el("ul");
+      children.forEach(function (c) { ul.appendChild(treeItem(c, seen)); });
+      details.appendChild(ul);
+    });
+    li.appendChild(details);
+    return li;
+  }
+
+  function renderTree() {
+    var ul = el("ul");
+    var seen = {};
+    data.roots.forEach(function (r) { seen[r] = true; });
+    data.roots.forEach(function (r) {
+      var li = treeItem(r, seen);
+      var details = li.querySelector("details");
+      if (details) { details.open = true; }
+      ul.appendChild(li);
+    });
+    document.getElementById("tree").appendChild(ul);
+  }
+
+  function linkList(indexes) {
+    if (!indexes || indexes.length === 0) { return el("span", {"class": "muted"}, "none"); }
+    var ul = el("ul");
+    indexes.forEach(function (i) {
+      var li = el("li");
+      li.appendChild(link(i));
+      ul.appendChild(li);
+    });
+    return ul;
+  }
+
+  function show(i) {
+    var n = nodes[i];
+    if (selected !== null) {
+      document.querySelectorAll("a.node.selected").forEach(function (a) { a.classList.remove("selected"); });
+    }
+    selected = i;
+    document.querySelectorAll('a.node[data-i="' + i + '"]').forEach(function (a) { a.classList.add("selected"); });
+
+    var panel = document.getElementById("details");
+    panel.textContent = "";
+    panel.appendChild(el("h2", {}, "Page details"));
+    var table = el("table");
+    function row(name, value) {
+      var tr = el("tr");
+      tr.appendChild(el("th", {}, name));
+      var td = el("td");
+      if (value instanceof Node) { td.appendChild(value); } else { td.textContent = value; }
+      tr.appendChild(td);
+      table.appendChild(tr);
+    }
+    row("URL", pageLink(n));
+    row("Title", n.title || "");
+    row("Status", statusName(n) + (n.noindex ? " (noindex)" : ""));
+    if (n.error) { row("Error", n.error); }
+    row("Depth", String(n.depth));
+    row("Inbound", String((n.in || []).length));
+    row("Outbound", String((n.out || []).length));
+    panel.appendChild(table);
+    panel.appendChild(el("h2", {}, "Linked from"));
+    panel.appendChild(linkList(n.in));
+    panel.appendChild(el("h2", {}, "Links to"));
+    panel.appendChild(linkList(n.out));
+  }
+
+  var maxResults = 200;
+  function search(query) {
+    var results = document.getElementById("results");
+    var tree = document.getElementById("tree");
+    query = query.trim().toLowerCase();
+    results.textContent = "";
+    if (query === "") {
+      results.hidden = true;
+      tree.hidden = false;
+      return;
+    }
+    var matches = [];
+    for (var i = 0; i < nodes.length; i++) {
+      var n = nodes[i];
+      if (n.url.toLowerCase().indexOf(query) >= 0 || (n.title || "").toLowerCase().indexOf(query) >= 0) {
+        matches.push(i);
+      }
+    }
+    results.appendChild(el("p", {"class": "muted"}, matches.length + " matching urls" +
+      (matches.length > maxResults ? ", showing the first " + maxResults : "")));
+    results.appendChild(linkList(matches.slice(0, maxResults)));
+    results.hidden = false;
+    tree.hidden = true;
+  }
+
+  function chart(id, counts, order, classOf) {
+    var max = 0;
+    order.forEach(function (k) { max = Math.max(max, counts[k]); });
+    var container = document.getElementById(id);
+    order.forEach(function (k) {
+      var bar = el("div", {"class": "bar"});
+      bar.appendChild(el("span", {"class": "name"}, k));
+      var fill = el("span", {"class": "fill " + (classOf ? classOf(k) : "")});
+      fill.style.width = (max ? counts[k] / max * 60 : 0) + "%";
+      bar.appendChild(fill);
+      bar.appendChild(el("span", {}, String(counts[k])));
+      container.appendChild(bar);
+    });
+  }
+
+  function renderCharts() {
+    var statuses = {}, statusClasses = {}, depths = {};
+    var crawled = 0, broken = 0;
+    nodes.forEach(function (n) {
+      var name = statusName(n);
+      statuses[name] = (statuses[name] || 0) + 1;
+      statusClasses[name] = statusClass(n);
+      if (n.crawled) {
+        crawled++;
+        depths[n.depth] = (depths[n.depth] || 0) + 1;
+        if (statusClass(n) === "s4" || statusClass(n) === "s5" || statusClass(n) === "failed") { broken++; }
+      }
+    });
+    chart("status-chart", statuses, Object.keys(statuses).sort(), function (k) { return statusClasses[k]; });
+    chart("depth-chart", depths, Object.keys(depths).sort(function (a, b) { return a - b; }));
+    document.getElementById("summary").textContent = nodes.length + " urls, " + crawled +
+      " pages crawled, " + broken + " failed";
+  }
+
+  renderCharts();
+  renderTree();
+  document.getElementById("search").addEventListener("input", function (e) { search(e.target.value); });
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,122 @@
+package sitemap_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+)
+
+func TestWriteHTML(t *testing.T) {
+	stmpMng := graphSiteManager()
+	stmpMng.Pages["https://example.com"].Title = "Home </script><script>alert(1)</script>"
+	stmpMng.Graph.AddLinks("https://example.com/about.html", []crawlers.Link{
+		{URL: "javascript:alert(document.cookie)", Element: "a"},
+	})
+
+	var buf bytes.Buffer
+	if err := stmpMng.WriteHTML(&buf); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	report := buf.String()
+
+	t.Run("it should not load anything from the network", func(t *testing.T) {
+		if loads := regexp.MustCompile(`<(script|link|img)[^>]+(src|href)=`).FindAllString(report, -1); len(loads) != 0 {
+			t.Errorf("expected no external resources, got %v", loads)
+		}
+	})
+
+	t.Run("it should escape page content", func(t *testing.T) {
+		if strings.Contains(report, "<script>alert(1)") {
+			t.Error("expected title to be escaped")
+		}
+	})
+
+	t.Run("it should embed the tree, page details and links", func(t *testing.T) {
+		match := regexp.MustCompile(`(?m)^  var data = (.*);$`).FindStringSubmatch(report)
+		if match == nil {
+			t.Fatalf("expected embedded data, got %s", report)
+		}
+		var data struct {
+			Roots []int
+			Nodes []struct {
+				URL      string
+				HTTP     bool
+				Title    string
+				Status   int
+				Depth    int
+				Crawled  bool
+				Children []int
+				In       []int
+				Out      []int
+			}
+		}
+		if err := json.Unmarshal([]byte(match[1]), &data); err != nil {
+			t.Fatalf("expected json, got %s", err)
+		}
+
+		var urls []string
+		for _, node := range data.Nodes {
+			urls = append(urls, node.URL)
+		}
+		expected := []string{
+			"https://example.com",
+			"https://example.com/blog/",
+			"https://example.com/blog/post.html",
+			"https://example.com/about.html",
+			"https://golang.org/",
+			"javascript:alert(document.cookie)",
+		}
+		if !reflect.DeepEqual(expected, urls) {
+			t.Fatalf("expected nodes %v, got %v", expected, urls)
+		}
+		if !reflect.DeepEqual([]int{0}, data.Roots) {
+			t.Errorf("expected roots [0], got %v", data.Roots)
+		}
+
+		root := data.Nodes[0]
+		if root.Title != "Home </script><script>alert(1)</script>" || root.Status != 200 || !root.Crawled {
+			t.Errorf("expected crawled root url with title, got %+v", root)
+		}
+		if !reflect.DeepEqual([]int{1, 3}, root.Children) {
+			t.Errorf("expected children [1 3], got %v", root.Children)
+		}
+		about := data.Nodes[3]
+		if about.Status != 500 || about.Depth != 1 || !reflect.DeepEqual([]int{0, 1}, about.In) {
+			t.Errorf("expected failed page linked from 2 pages, got %+v", about)
+		}
+		blog := data.Nodes[1]
+		if !reflect.DeepEqual([]int{2, 3, 4}, blog.Out) {
+			t.Errorf("expected links to [2 3 4], got %v", blog.Out)
+		}
+		golang := data.Nodes[4]
+		if golang.Crawled || golang.Depth != 2 {
+			t.Errorf("expected url not crawled at depth 2, got %+v", golang)
+		}
+	})
+	t.Run("it should link only to http and https urls", func(t *testing.T) {
+		match := regexp.MustCompile(`(?m)^  var data = (.*);$`).FindStringSubmatch(report)
+		if match == nil {
+			t.Fatalf("expected embedded data, got %s", report)
+		}
+		var data struct {
+			Nodes []struct {
+				URL  string
+				HTTP bool
+			}
+		}
+		if err := json.Unmarshal([]byte(match[1]), &data); err != nil {
+			t.Fatalf("expected json, got %s", err)
+		}
+		for _, node := range data.Nodes {
+			expected := strings.HasPrefix(node.URL, "https://")
+			if node.HTTP != expected {
+				t.Errorf("expected http %t for %s, got %t", expected, node.URL, node.HTTP)
+			}
+		}
+	})
+}
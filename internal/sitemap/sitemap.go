@@ -1,49 +1,139 @@
 package sitemap
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
 // Crawler interface defines the behavior of a Crawler
+// Crawl starts from one or more root urls which share one crawl
+// when ctx is cancelled Crawl returns the partial result along with ctx.Err()
 type Crawler interface {
-	Crawl(url string) (map[string]Children, error)
+	Crawl(ctx context.Context, urls ...string) (*Result, error)
 }
 
 // Children defines a list of children links in a html page
 type Children []string
 
+// Page defines a crawled url and the response metadata of its fetch
+// Depth is the number of clicks from the root url, Err holds the error of a failed fetch
+// Outcome tells how the fetch went, urls disallowed by robots.txt are pages which were never fetched
+type Page struct {
+	crawlers.FetchResult
+	Depth   int
+	Err     error
+	Outcome crawlers.Outcome
+}
+
+// Result defines the outcome of a crawl
+// Roots are the canonical forms of the crawled root urls
+// Sitemap holds the children of every url, Pages holds the crawled urls
+// Graph holds every link found in the crawled pages
+type Result struct {
+	Roots   []string
+	Sitemap map[string]Children
+	Pages   map[string]*Page
+	Graph   *Graph
+}
+
+// NewResult creates and returns an empty Result
+func NewResult() *Result {
+	return &Result{
+		Sitemap: map[string]Children{},
+		Pages:   map[string]*Page{},
+		Graph:   NewGraph(),
+	}
+}
+
+// NewPage creates and returns the Page of a url fetched depth clicks away from the nearest root url
+// fetched may be nil when the fetch failed before a response was received
+func NewPage(url string, depth int, fetched *crawlers.FetchResult, err error) *Page {
+	page := &Page{Depth: depth, Err: err, Outcome: crawlers.Classify(fetched, err)}
+	if fetched != nil {
+		page.FetchResult = *fetched
+	}
+	page.URL = url
+	return page
+}
+
+// AddPage records the fetch of a url found depth clicks away from the nearest root url
+// fetched may be nil when the fetch failed before a response was received
+func (r *Result) AddPage(url string, depth int, fetched *crawlers.FetchResult, err error) {
+	r.Pages[url] = NewPage(url, depth, fetched, err)
+}
+
+// Failures returns the number of pages whose fetch failed
+func (r *Result) Failures() int {
+	n := 0
+	for _, page := range r.Pages {
+		if page.Outcome.Failed() {
+			n++
+		}
+	}
+	return n
+}
+
 // SiteMapManager defines a sitemap generator
 // SiteMapManager can work on a link and generate its sitemap
 type SiteMapManager struct {
-	rootDomain string
-	Sitemap    map[string]Children
-	urlQueue   []string
-	crawler    Crawler
+	roots    []string
+	Sitemap  map[string]Children
+	Pages    map[string]*Page
+	Graph    *Graph
+	urlQueue []string
+	crawler  Crawler
 }
 
 // NewSiteManager creates and returns a SiteMapManager
 func NewSiteManager(url string, crawler Crawler) *SiteMapManager {
+	return NewSeededSiteManager([]string{url}, crawler)
+}
+
+// NewSeededSiteManager creates and returns a SiteMapManager
+// which crawls a site starting from several root urls
+func NewSeededSiteManager(urls []string, crawler Crawler) *SiteMapManager {
 	return &SiteMapManager{
-		rootDomain: url,
-		Sitemap:    map[string]Children{},
-		urlQueue:   []string{url},
-		crawler:    crawler,
+		roots:    urls,
+		Sitemap:  map[string]Children{},
+		Pages:    map[string]*Page{},
+		Graph:    NewGraph(),
+		urlQueue: urls,
+		crawler:  crawler,
 	}
 }
 
-// Crawl crawls a site starting from specified root url
-// Crawl popolates the Sitemap map[string]Children
-func (sm *SiteMapManager) Crawl() {
-	var err error
-	sm.Sitemap, err = sm.crawler.Crawl(sm.rootDomain)
+// Crawl crawls a site starting from specified root urls
+// Crawl popolates the Sitemap map[string]Children, Pages map[string]*Page and the link Graph
+// a crawl stopped by cancelling ctx keeps the pages crawled so far
+// the error the crawl stopped with is returned
+func (sm *SiteMapManager) Crawl(ctx context.Context) error {
+	result, err := sm.crawler.Crawl(ctx, sm.roots...)
 	if err != nil {
 		log.Error("sitemap : ", err)
 	}
+	if result != nil {
+		if len(result.Roots) > 0 {
+			sm.roots = result.Roots
+		}
+		sm.Sitemap = result.Sitemap
+		sm.Pages = result.Pages
+		if result.Graph != nil {
+			sm.Graph = result.Graph
+		}
+	}
+	return err
+}
+
+// Roots returns the root urls of the sitemap
+func (sm *SiteMapManager) Roots() []string {
+	return sm.roots
 }
 
 // PrintMap prints site map as a tree
@@ -52,21 +142,31 @@ func (sm *SiteMapManager) PrintMap() {
 }
 
 // FPrintMap writes site map as a tree to io.Writer
+// every root url is written as a separate tree
 func (sm *SiteMapManager) FPrintMap(w io.Writer) {
-	fmt.Fprintf(w, "\n::::: Site Map: %s ::::\n", sm.rootDomain)
 	trim := viper.GetBool("TRIM_ROOT")
-	sm.printTree(w, sm.rootDomain, 0, trim)
+	for _, root := range sm.roots {
+		fmt.Fprintf(w, "\n::::: Site Map: %s ::::\n", root)
+		sm.printTree(w, root, root, 0, trim)
+	}
 }
 
-func (sm *SiteMapManager) printTree(w io.Writer, url string, depth int, trim bool) {
+func (sm *SiteMapManager) printTree(w io.Writer, root, url string, depth int, trim bool) {
 
+	// only urls under root domain can be trimmed
+	// links of other hosts in scope are printed in full
 	skipLen := 0
-	if trim {
-		skipLen = len(sm.rootDomain)
+	if trim && strings.HasPrefix(url, root) {
+		skipLen = len(root)
+	}
+	// noindex pages are listed but marked so they are not taken as ordinary entries
+	marker := ""
+	if page, ok := sm.Pages[url]; ok && page.NoIndex {
+		marker = " [noindex]"
 	}
-	fmt.Fprintf(w, "%*s%s\n", depth, "", url[skipLen:])
+	fmt.Fprintf(w, "%*s%s%s\n", depth, "", url[skipLen:], marker)
 
 	for _, val := range sm.Sitemap[url] {
-		sm.printTree(w, val, depth+2, trim)
+		sm.printTree(w, root, val, depth+2, trim)
 	}
 }
@@ -2,16 +2,23 @@ package sitemap_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"testing"
 
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
 	"github.com/nikhil-thomas/web-crawler/internal/sitemap"
 )
 
-type stubCrawler struct{}
+type stubCrawler struct {
+	noIndex []string
+	err     error
+}
 
-func (sc *stubCrawler) Crawl(url string) (map[string]sitemap.Children, error) {
-	stmp := map[string]sitemap.Children{
+func (sc *stubCrawler) Crawl(ctx context.Context, urls ...string) (*sitemap.Result, error) {
+	result := sitemap.NewResult()
+	result.Roots = urls
+	result.Sitemap = map[string]sitemap.Children{
 		"https://example.com": sitemap.Children{
 			"https://example.com/about.html",
 			"https://example.com/contact.html",
@@ -25,7 +32,12 @@ func (sc *stubCrawler) Crawl(url string) (map[string]sitemap.Children, error) {
 			"https://example.com/contact/rev2.html",
 		},
 	}
-	return stmp, nil
+	for _, url := range sc.noIndex {
+		result.Pages[url] = &sitemap.Page{
+			FetchResult: crawlers.FetchResult{URL: url, NoIndex: true},
+		}
+	}
+	return result, sc.err
 }
 
 func TestSiteMapManager(t *testing.T) {
@@ -46,7 +58,7 @@ func TestSiteMapManager(t *testing.T) {
 			"https://example.com",
 			crawler,
 		)
-		stmpMng.Crawl()
+		stmpMng.Crawl(context.Background())
 
 		stmp := stmpMng.Sitemap
 
@@ -65,7 +77,7 @@ func TestSiteMapManager(t *testing.T) {
 			"https://example.com",
 			crawler,
 		)
-		stmpMng.Crawl()
+		stmpMng.Crawl(context.Background())
 
 		got := &bytes.Buffer{}
 
@@ -73,7 +85,6 @@ func TestSiteMapManager(t *testing.T) {
 
 		expected := `
 ::::: Site Map: https://example.com ::::
-
 https://example.com
   https://example.com/about.html
     https://example.com/about/rev1.html
@@ -87,4 +98,73 @@ https://example.com
 			t.Errorf("expected %s, got %s", expected, got)
 		}
 	})
+
+	t.Run("it should mark noindex pages", func(t *testing.T) {
+		stmpMng := sitemap.NewSiteManager(
+			"https://example.com",
+			&stubCrawler{noIndex: []string{"https://example.com/contact.html"}},
+		)
+		stmpMng.Crawl(context.Background())
+
+		got := &bytes.Buffer{}
+
+		stmpMng.FPrintMap(got)
+
+		expected := `
+::::: Site Map: https://example.com ::::
+https://example.com
+  https://example.com/about.html
+    https://example.com/about/rev1.html
+    https://example.com/about/rev2.html
+  https://example.com/contact.html [noindex]
+    https://example.com/contact/rev1.html
+    https://example.com/contact/rev2.html
+`
+
+		if expected != got.String() {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	})
+
+	t.Run("it should print a tree for every root url", func(t *testing.T) {
+		stmpMng := sitemap.NewSeededSiteManager(
+			[]string{"https://example.com/about.html", "https://example.com/contact.html"},
+			crawler,
+		)
+		stmpMng.Crawl(context.Background())
+
+		got := &bytes.Buffer{}
+
+		stmpMng.FPrintMap(got)
+
+		expected := `
+::::: Site Map: https://example.com/about.html ::::
+https://example.com/about.html
+  https://example.com/about/rev1.html
+  https://example.com/about/rev2.html
+
+::::: Site Map: https://example.com/contact.html ::::
+https://example.com/contact.html
+  https://example.com/contact/rev1.html
+  https://example.com/contact/rev2.html
+`
+
+		if expected != got.String() {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	})
+	t.Run("it should keep a partial sitemap and return the error the crawl stopped with", func(t *testing.T) {
+		stmpMng := sitemap.NewSiteManager(
+			"https://example.com",
+			&stubCrawler{err: context.Canceled},
+		)
+		err := stmpMng.Crawl(context.Background())
+
+		if err != context.Canceled {
+			t.Errorf("expected %s, got %v", context.Canceled, err)
+		}
+		if len(stmpMng.Sitemap) == 0 {
+			t.Error("expected the pages crawled so far to be kept")
+		}
+	})
 }
@@ -0,0 +1,474 @@
+package sitemap
+
+import (
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+)
+
+const (
+	// MaxXMLURLs is the largest number of urls in a sitemap file of the sitemaps.org protocol
+	MaxXMLURLs = 50000
+	// MaxXMLBytes is the largest size of an uncompressed sitemap file of the sitemaps.org protocol
+	MaxXMLBytes = 50 << 20
+	// xmlNamespace is the namespace of sitemap and sitemap index files
+	xmlNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+)
+
+// ChangeFreqs are the change frequencies of the sitemaps.org protocol
+var ChangeFreqs = []string{"always", "hourly", "daily", "weekly", "monthly", "yearly", "never"}
+
+// XMLRule sets the changefreq or the priority of the urls whose path matches Pattern
+type XMLRule struct {
+	Pattern *regexp.Regexp
+	Value   string
+}
+
+// ParseChangeFreqRule parses a "pattern=changefreq" rule, eg: /blog/*=daily
+// the pattern is a path pattern as accepted by crawlers.ParsePathPattern
+func ParseChangeFreqRule(rule string) (XMLRule, error) {
+	xr, err := parseXMLRule(rule)
+	if err != nil {
+		return XMLRule{}, err
+	}
+	xr.Value = strings.ToLower(xr.Value)
+	for _, freq := range ChangeFreqs {
+		if xr.Value == freq {
+			return xr, nil
+		}
+	}
+	return XMLRule{}, fmt.Errorf("sitemap : changefreq rule : %q : expected one of %s", rule, strings.Join(ChangeFreqs, ", "))
+}
+
+// ParsePriorityRule parses a "pattern=priority" rule, eg: /=1.0
+// the priority is a number between 0.0 and 1.0
+func ParsePriorityRule(rule string) (XMLRule, error) {
+	xr, err := parseXMLRule(rule)
+	if err != nil {
+		return XMLRule{}, err
+	}
+	priority, err := strconv.ParseFloat(xr.Value, 64)
+	if err != nil || priority < 0 || priority > 1 {
+		return XMLRule{}, fmt.Errorf("sitemap : priority rule : %q : expected a priority between 0.0 and 1.0", rule)
+	}
+	xr.Value = strconv.FormatFloat(priority, 'f', 1, 64)
+	return xr, nil
+}
+
+func parseXMLRule(rule string) (XMLRule, error) {
+	i := strings.LastIndex(rule, "=")
+	if i < 0 {
+		return XMLRule{}, fmt.Errorf("sitemap : rule : %q : expected 'pattern=value'", rule)
+	}
+	pattern, err := crawlers.ParsePathPattern(strings.TrimSpace(rule[:i]))
+	if err != nil {
+		return XMLRule{}, fmt.Errorf("sitemap : rule : %q : %s", rule, err)
+	}
+	return XMLRule{Pattern: pattern, Value: strings.TrimSpace(rule[i+1:])}, nil
+}
+
+// matchRule returns the value of the first rule matching the path of u
+func matchRule(rules []XMLRule, u *url.URL) string {
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	for _, rule := range rules {
+		if rule.Pattern.MatchString(p) {
+			return rule.Value
+		}
+	}
+	return ""
+}
+
+// XMLOptions defines how sitemaps.org sitemap files are written
+type XMLOptions struct {
+	// BaseURL is the url the files are published under, the sitemap index points to it
+	// the host of the first root url is used when it is empty
+	BaseURL string
+	// Gzip compresses the files, .gz is added to their names
+	Gzip bool
+	// ChangeFreq and Priority set the changefreq and priority of urls, the first matching rule is used
+	ChangeFreq []XMLRule
+	Priority   []XMLRule
+	// Normalizer canonicalizes redirect and <link rel="canonical"> urls before they are compared with page urls
+	Normalizer *crawlers.Normalizer
+	// MaxURLs and MaxBytes split the urls into several files, the protocol limits are used when 0
+	MaxURLs  int
+	MaxBytes int
+	// MaxSitemaps splits the sitemap index into several files, the protocol limit is used when 0
+	MaxSitemaps int
+}
+
+// xmlURL defines a <url> entry of a sitemap file
+type xmlURL struct {
+	XMLName    xml.Name `xml:"url"`
+	Loc        string   `xml:"loc"`
+	LastMod    string   `xml:"lastmod,omitempty"`
+	ChangeFreq string   `xml:"changefreq,omitempty"`
+	Priority   string   `xml:"priority,omitempty"`
+}
+
+// xmlSitemap defines a <sitemap> entry of a sitemap index file
+type xmlSitemap struct {
+	XMLName xml.Name `xml:"sitemap"`
+	Loc     string   `xml:"loc"`
+}
+
+// WriteXML writes the indexable pages of the sitemap to dir as sitemaps.org sitemap files
+// and returns the paths of the files written
+// pages are written in the order of the sitemap tree, see XMLWriter for the files written
+func (sm *SiteMapManager) WriteXML(dir string, opts XMLOptions) ([]string, error) {
+	xw := NewXMLWriter(dir, opts)
+	for _, pageURL := range sm.treeOrder() {
+		if page, ok := sm.Pages[pageURL]; ok {
+			xw.Add(page)
+		}
+	}
+	return xw.Close(sm.roots)
+}
+
+// XMLWriter writes indexable pages to dir as sitemaps.org sitemap files as they are added
+// pages are written to sitemap.xml, when there are more than one file can hold
+// they are split into sitemap-1.xml, sitemap-2.xml... listed by the sitemap index sitemap.xml
+// an index lists at most MaxSitemaps files, above that it is split into
+// sitemap-index-1.xml, sitemap-index-2.xml... which are all to be submitted
+// every file is streamed to disk as its entries are written
+type XMLWriter struct {
+	opts     XMLOptions
+	ext      string
+	sitemaps *xmlFiles
+	// err is the first error of Add, it is returned by Close
+	err error
+}
+
+// NewXMLWriter creates and returns an XMLWriter which writes to dir
+func NewXMLWriter(dir string, opts XMLOptions) *XMLWriter {
+	if opts.Normalizer == nil {
+		opts.Normalizer = &crawlers.Normalizer{}
+	}
+	if opts.MaxURLs <= 0 || opts.MaxURLs > MaxXMLURLs {
+		opts.MaxURLs = MaxXMLURLs
+	}
+	if opts.MaxBytes <= 0 || opts.MaxBytes > MaxXMLBytes {
+		opts.MaxBytes = MaxXMLBytes
+	}
+	if opts.MaxSitemaps <= 0 || opts.MaxSitemaps > MaxXMLURLs {
+		opts.MaxSitemaps = MaxXMLURLs
+	}
+	ext := ".xml"
+	if opts.Gzip {
+		ext += ".gz"
+	}
+	return &XMLWriter{
+		opts: opts,
+		ext:  ext,
+		sitemaps: &xmlFiles{
+			root:     "urlset",
+			name:     func(i int) string { return fmt.Sprintf("sitemap-%d%s", i, ext) },
+			dir:      dir,
+			gz:       opts.Gzip,
+			maxURLs:  opts.MaxURLs,
+			maxBytes: opts.MaxBytes,
+		},
+	}
+}
+
+// Add writes page when it is indexable
+// once a write failed nothing more is written and the error is returned again
+func (xw *XMLWriter) Add(page *Page) error {
+	if xw.err != nil || !Indexable(page, xw.opts.Normalizer) {
+		return xw.err
+	}
+	u, err := url.Parse(page.URL)
+	if err != nil {
+		return nil
+	}
+	entry := xmlURL{
+		Loc:        page.URL,
+		LastMod:    lastModified(page),
+		ChangeFreq: matchRule(xw.opts.ChangeFreq, u),
+		Priority:   matchRule(xw.opts.Priority, u),
+	}
+	data, err := xmlEntry(entry)
+	if err == nil {
+		err = xw.sitemaps.write(data)
+	}
+	xw.err = err
+	return err
+}
+
+// Close completes the sitemap files, writes the sitemap index when there are several
+// and returns the paths of the files written
+// an empty urlset is written when no page is indexable
+// the index points to the host of the first of roots when the base url is not set
+func (xw *XMLWriter) Close(roots []string) ([]string, error) {
+	sitemaps := xw.sitemaps
+	if xw.err == nil && len(sitemaps.paths) == 0 {
+		xw.err = sitemaps.next()
+	}
+	if xw.err != nil {
+		sitemaps.close()
+		return sitemaps.paths, xw.err
+	}
+	if err := sitemaps.close(); err != nil {
+		return sitemaps.paths, err
+	}
+	if len(sitemaps.paths) == 1 {
+		return sitemaps.single("sitemap" + xw.ext)
+	}
+
+	base, err := xmlBaseURL(xw.opts.BaseURL, roots)
+	if err != nil {
+		return sitemaps.paths, err
+	}
+	index := &xmlFiles{
+		root:     "sitemapindex",
+		name:     func(i int) string { return fmt.Sprintf("sitemap-index-%d%s", i, xw.ext) },
+		dir:      sitemaps.dir,
+		gz:       xw.opts.Gzip,
+		maxURLs:  xw.opts.MaxSitemaps,
+		maxBytes: xw.opts.MaxBytes,
+	}
+	for i := range sitemaps.paths {
+		loc, _ := base.Parse(sitemaps.name(i + 1))
+		data, err := xmlEntry(xmlSitemap{Loc: loc.String()})
+		if err == nil {
+			err = index.write(data)
+		}
+		if err != nil {
+			index.close()
+			return append(index.paths, sitemaps.paths...), err
+		}
+	}
+	if err := index.close(); err != nil {
+		return append(index.paths, sitemaps.paths...), err
+	}
+	if len(index.paths) == 1 {
+		paths, err := index.single("sitemap" + xw.ext)
+		return append(paths, sitemaps.paths...), err
+	}
+	return append(index.paths, sitemaps.paths...), nil
+}
+
+// treeOrder returns the urls of the sitemap tree, every url once, in the order they are printed
+func (sm *SiteMapManager) treeOrder() []string {
+	var urls []string
+	seen := map[string]bool{}
+	var walk func(url string)
+	walk = func(url string) {
+		if seen[url] {
+			return
+		}
+		seen[url] = true
+		urls = append(urls, url)
+		for _, child := range sm.Sitemap[url] {
+			walk(child)
+		}
+	}
+	for _, root := range sm.roots {
+		walk(root)
+	}
+	return urls
+}
+
+// xmlBaseURL returns the url the sitemap files are published under
+// the host of the first root url is used when baseURL is empty
+func xmlBaseURL(baseURL string, roots []string) (*url.URL, error) {
+	if baseURL == "" && len(roots) > 0 {
+		root, err := url.Parse(roots[0])
+		if err != nil {
+			return nil, fmt.Errorf("sitemap : base url : %s", err)
+		}
+		baseURL = root.Scheme + "://" + root.Host + "/"
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("sitemap : base url : %q : expected an absolute url", baseURL)
+	}
+	return base, nil
+}
+
+// Indexable reports whether a page belongs in a sitemap.xml
+// pages which are noindex, did not respond with 200, were redirected
+// or name another url as canonical are left out
+func Indexable(page *Page, normalizer *crawlers.Normalizer) bool {
+	if page.NoIndex || page.StatusCode != http.StatusOK {
+		return false
+	}
+	if page.Outcome != crawlers.OutcomeOK && page.Outcome != crawlers.OutcomeNotHTML {
+		return false
+	}
+	if page.FinalURL != "" && normalizer.Normalize(page.FinalURL) != page.URL {
+		return false
+	}
+	return page.Canonical == "" || normalizer.Normalize(page.Canonical) == page.URL
+}
+
+// lastModified returns the Last-Modified header of a page in W3C datetime format
+func lastModified(page *Page) string {
+	t, err := http.ParseTime(page.Header.Get("Last-Modified"))
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// xmlFile streams the entries of a sitemap or sitemap index file to disk
+// urls and size count the entries and the uncompressed bytes written so far
+type xmlFile struct {
+	root string
+	path string
+	f    *os.File
+	zw   *gzip.Writer
+	w    io.Writer
+	urls int
+	size int
+}
+
+// createXMLFile creates path and writes the header of a file with root element root
+func createXMLFile(path, root string, gz bool) (*xmlFile, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("sitemap : %s", err)
+	}
+	xf := &xmlFile{root: root, path: path, f: f, w: f}
+	if gz {
+		xf.zw = gzip.NewWriter(f)
+		xf.w = xf.zw
+	}
+	if err := xf.writeString(xf.header()); err != nil {
+		xf.close()
+		return nil, err
+	}
+	return xf, nil
+}
+
+func (xf *xmlFile) header() string {
+	return fmt.Sprintf("%s<%s xmlns=%q>\n", xml.Header, xf.root, xmlNamespace)
+}
+
+func (xf *xmlFile) footer() string {
+	return fmt.Sprintf("</%s>\n", xf.root)
+}
+
+// fits reports whether a marshalled entry can be added without going over the limits
+func (xf *xmlFile) fits(data []byte, maxURLs, maxBytes int) bool {
+	return xf.urls < maxURLs && xf.size+len(data)+len(xf.footer()) <= maxBytes
+}
+
+// write appends a marshalled entry to the file
+func (xf *xmlFile) write(data []byte) error {
+	if _, err := xf.w.Write(data); err != nil {
+		return fmt.Errorf("sitemap : %s : %s", xf.path, err)
+	}
+	xf.size += len(data)
+	xf.urls++
+	return nil
+}
+
+func (xf *xmlFile) writeString(s string) error {
+	if _, err := io.WriteString(xf.w, s); err != nil {
+		return fmt.Errorf("sitemap : %s : %s", xf.path, err)
+	}
+	xf.size += len(s)
+	return nil
+}
+
+// close writes the footer of the file and closes it
+func (xf *xmlFile) close() error {
+	err := xf.writeString(xf.footer())
+	if xf.zw != nil {
+		if cerr := xf.zw.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("sitemap : %s : %s", xf.path, cerr)
+		}
+	}
+	if cerr := xf.f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("sitemap : %s : %s", xf.path, cerr)
+	}
+	return err
+}
+
+// xmlFiles writes entries to a series of files named name(1), name(2)...
+// a new file is started when an entry would take the current one over maxURLs or maxBytes
+type xmlFiles struct {
+	root     string
+	name     func(i int) string
+	dir      string
+	gz       bool
+	maxURLs  int
+	maxBytes int
+	file     *xmlFile
+	paths    []string
+}
+
+// write appends a marshalled entry to the current file
+func (xfs *xmlFiles) write(data []byte) error {
+	if xfs.file != nil && xfs.file.urls > 0 && !xfs.file.fits(data, xfs.maxURLs, xfs.maxBytes) {
+		if err := xfs.next(); err != nil {
+			return err
+		}
+	}
+	if xfs.file == nil {
+		if err := xfs.next(); err != nil {
+			return err
+		}
+	}
+	return xfs.file.write(data)
+}
+
+// next closes the current file and starts the next one
+func (xfs *xmlFiles) next() error {
+	if err := xfs.close(); err != nil {
+		return err
+	}
+	path := filepath.Join(xfs.dir, xfs.name(len(xfs.paths)+1))
+	file, err := createXMLFile(path, xfs.root, xfs.gz)
+	if err != nil {
+		return err
+	}
+	xfs.file = file
+	xfs.paths = append(xfs.paths, path)
+	return nil
+}
+
+// close closes the current file
+func (xfs *xmlFiles) close() error {
+	if xfs.file == nil {
+		return nil
+	}
+	err := xfs.file.close()
+	xfs.file = nil
+	return err
+}
+
+// single renames the only file written to name
+func (xfs *xmlFiles) single(name string) ([]string, error) {
+	path := filepath.Join(xfs.dir, name)
+	if err := os.Rename(xfs.paths[0], path); err != nil {
+		return xfs.paths, fmt.Errorf("sitemap : %s", err)
+	}
+	return []string{path}, nil
+}
+
+func xmlEntry(entry interface{}) ([]byte, error) {
+	data, err := xml.MarshalIndent(entry, "  ", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("sitemap : xml : %s", err)
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,304 @@
+package sitemap_test
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nikhil-thomas/web-crawler/internal/crawlers"
+	"github.com/nikhil-thomas/web-crawler/internal/sitemap"
+)
+
+type resultCrawler struct {
+	result *sitemap.Result
+}
+
+func (rc *resultCrawler) Crawl(ctx context.Context, urls ...string) (*sitemap.Result, error) {
+	return rc.result, nil
+}
+
+func xmlSiteManager() *sitemap.SiteMapManager {
+	result := sitemap.NewResult()
+	result.Roots = []string{"https://example.com"}
+	result.Sitemap = map[string]sitemap.Children{
+		"https://example.com": sitemap.Children{
+			"https://example.com/blog/",
+			"https://example.com/about.html?lang=en&x=1",
+			"https://example.com/private.html",
+			"https://example.com/missing.html",
+			"https://example.com/old.html",
+			"https://example.com/copy.html",
+			"https://example.com/logo.png",
+		},
+		"https://example.com/blog/": sitemap.Children{
+			"https://example.com/blog/post.html",
+		},
+	}
+	page := func(url string, status int, header http.Header) *crawlers.FetchResult {
+		return &crawlers.FetchResult{URL: url, FinalURL: url, StatusCode: status, Header: header}
+	}
+	lastModified := http.Header{"Last-Modified": []string{"Tue, 15 Sep 2020 10:30:00 GMT"}}
+	result.AddPage("https://example.com", 0, page("https://example.com", 200, lastModified), nil)
+	result.AddPage("https://example.com/blog/", 1, page("https://example.com/blog/", 200, nil), nil)
+	result.AddPage("https://example.com/blog/post.html", 2, page("https://example.com/blog/post.html", 200, nil), nil)
+	result.AddPage("https://example.com/about.html?lang=en&x=1", 1, page("https://example.com/about.html?lang=en&x=1", 200, nil), nil)
+
+	private := page("https://example.com/private.html", 200, nil)
+	private.NoIndex = true
+	result.AddPage(private.URL, 1, private, nil)
+
+	missing := page("https://example.com/missing.html", 404, nil)
+	result.AddPage(missing.URL, 1, missing, &crawlers.StatusError{URL: missing.URL, StatusCode: 404})
+
+	old := page("https://example.com/old.html", 200, nil)
+	old.FinalURL = "https://example.com/new.html"
+	result.AddPage(old.URL, 1, old, nil)
+
+	copied := page("https://example.com/copy.html", 200, nil)
+	copied.Canonical = "https://EXAMPLE.com/blog/post.html#top"
+	result.AddPage(copied.URL, 1, copied, nil)
+
+	return sitemap.NewSiteManager("https://example.com", &resultCrawler{result: result})
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var data []byte
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err = ioutil.ReadAll(zr)
+	} else {
+		data, err = ioutil.ReadAll(f)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestWriteXML(t *testing.T) {
+	stmpMng := xmlSiteManager()
+	stmpMng.Crawl(context.Background())
+
+	dir, err := ioutil.TempDir("", "sitemap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("it should write the indexable pages as a urlset", func(t *testing.T) {
+		daily, _ := sitemap.ParseChangeFreqRule("/blog/*=daily")
+		top, _ := sitemap.ParsePriorityRule("/=1")
+		paths, err := stmpMng.WriteXML(dir, sitemap.XMLOptions{
+			ChangeFreq: []sitemap.XMLRule{daily},
+			Priority:   []sitemap.XMLRule{top},
+		})
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+		if len(paths) != 1 || paths[0] != filepath.Join(dir, "sitemap.xml") {
+			t.Fatalf("expected sitemap.xml, got %v", paths)
+		}
+
+		expected := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url>
+    <loc>https://example.com</loc>
+    <lastmod>2020-09-15T10:30:00Z</lastmod>
+    <priority>1.0</priority>
+  </url>
+  <url>
+    <loc>https://example.com/blog/</loc>
+    <changefreq>daily</changefreq>
+  </url>
+  <url>
+    <loc>https://example.com/blog/post.html</loc>
+    <changefreq>daily</changefreq>
+  </url>
+  <url>
+    <loc>https://example.com/about.html?lang=en&amp;x=1</loc>
+  </url>
+</urlset>
+`
+		if got := readFile(t, paths[0]); expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	})
+
+	t.Run("it should split large sitemaps and write a sitemap index", func(t *testing.T) {
+		paths, err := stmpMng.WriteXML(dir, sitemap.XMLOptions{
+			BaseURL: "https://cdn.example.com/sitemaps",
+			Gzip:    true,
+			MaxURLs: 3,
+		})
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+		expectedPaths := []string{
+			filepath.Join(dir, "sitemap.xml.gz"),
+			filepath.Join(dir, "sitemap-1.xml.gz"),
+			filepath.Join(dir, "sitemap-2.xml.gz"),
+		}
+		if strings.Join(expectedPaths, ",") != strings.Join(paths, ",") {
+			t.Fatalf("expected %v, got %v", expectedPaths, paths)
+		}
+
+		expected := `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap>
+    <loc>https://cdn.example.com/sitemaps/sitemap-1.xml.gz</loc>
+  </sitemap>
+  <sitemap>
+    <loc>https://cdn.example.com/sitemaps/sitemap-2.xml.gz</loc>
+  </sitemap>
+</sitemapindex>
+`
+		if got := readFile(t, paths[0]); expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+		if n := strings.Count(readFile(t, paths[1]), "<url>"); n != 3 {
+			t.Errorf("expected 3 urls in first sitemap, got %d", n)
+		}
+		if n := strings.Count(readFile(t, paths[2]), "<url>"); n != 1 {
+			t.Errorf("expected 1 url in second sitemap, got %d", n)
+		}
+	})
+
+	t.Run("it should split sitemaps larger than the maximum size", func(t *testing.T) {
+		paths, err := stmpMng.WriteXML(dir, sitemap.XMLOptions{MaxBytes: 250})
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+		if len(paths) < 3 {
+			t.Fatalf("expected an index and several sitemaps, got %v", paths)
+		}
+		urls := 0
+		for _, path := range paths[1:] {
+			content := readFile(t, path)
+			if len(content) > 250 {
+				t.Errorf("expected at most 250 bytes, got %d in %s", len(content), path)
+			}
+			urls += strings.Count(content, "<url>")
+		}
+		if urls != 4 {
+			t.Errorf("expected 4 urls, got %d", urls)
+		}
+	})
+
+	t.Run("it should split the sitemap index when it lists too many sitemaps", func(t *testing.T) {
+		paths, err := stmpMng.WriteXML(dir, sitemap.XMLOptions{MaxURLs: 1, MaxSitemaps: 3})
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+		expectedPaths := []string{
+			filepath.Join(dir, "sitemap-index-1.xml"),
+			filepath.Join(dir, "sitemap-index-2.xml"),
+			filepath.Join(dir, "sitemap-1.xml"),
+			filepath.Join(dir, "sitemap-2.xml"),
+			filepath.Join(dir, "sitemap-3.xml"),
+			filepath.Join(dir, "sitemap-4.xml"),
+		}
+		if strings.Join(expectedPaths, ",") != strings.Join(paths, ",") {
+			t.Fatalf("expected %v, got %v", expectedPaths, paths)
+		}
+		if n := strings.Count(readFile(t, paths[0]), "<sitemap>"); n != 3 {
+			t.Errorf("expected 3 sitemaps in first index, got %d", n)
+		}
+		expected := `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap>
+    <loc>https://example.com/sitemap-4.xml</loc>
+  </sitemap>
+</sitemapindex>
+`
+		if got := readFile(t, paths[1]); expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	})
+
+	t.Run("it should write an empty urlset when no page is indexable", func(t *testing.T) {
+		emptyDir, err := ioutil.TempDir("", "sitemap")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(emptyDir)
+		emptyMng := sitemap.NewSiteManager("https://example.com", &resultCrawler{result: sitemap.NewResult()})
+		emptyMng.Crawl(context.Background())
+
+		paths, err := emptyMng.WriteXML(emptyDir, sitemap.XMLOptions{})
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+		if len(paths) != 1 || paths[0] != filepath.Join(emptyDir, "sitemap.xml") {
+			t.Fatalf("expected sitemap.xml, got %v", paths)
+		}
+		expected := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+</urlset>
+`
+		if got := readFile(t, paths[0]); expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	})
+
+	t.Run("it should write pages as they are added to an xml writer", func(t *testing.T) {
+		streamDir, err := ioutil.TempDir("", "sitemap")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(streamDir)
+
+		xw := sitemap.NewXMLWriter(streamDir, sitemap.XMLOptions{MaxURLs: 1})
+		fetched := &crawlers.FetchResult{StatusCode: 200}
+		xw.Add(sitemap.NewPage("https://example.com", 0, fetched, nil))
+		xw.Add(sitemap.NewPage("https://example.com/missing.html", 1, nil, &crawlers.StatusError{URL: "https://example.com/missing.html", StatusCode: 404}))
+		xw.Add(sitemap.NewPage("https://example.com/about.html", 1, fetched, nil))
+		paths, err := xw.Close([]string{"https://example.com"})
+
+		if err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+		expectedPaths := []string{
+			filepath.Join(streamDir, "sitemap.xml"),
+			filepath.Join(streamDir, "sitemap-1.xml"),
+			filepath.Join(streamDir, "sitemap-2.xml"),
+		}
+		if strings.Join(expectedPaths, ",") != strings.Join(paths, ",") {
+			t.Fatalf("expected %v, got %v", expectedPaths, paths)
+		}
+		if !strings.Contains(readFile(t, paths[2]), "<loc>https://example.com/about.html</loc>") {
+			t.Errorf("expected about.html in second sitemap, got %s", readFile(t, paths[2]))
+		}
+	})
+
+	t.Run("it should reject invalid rules", func(t *testing.T) {
+		for _, rule := range []string{"/blog/*=sometimes", "/blog/*"} {
+			if _, err := sitemap.ParseChangeFreqRule(rule); err == nil {
+				t.Errorf("expected error for %q, got nil", rule)
+			}
+		}
+		for _, rule := range []string{"/=1.5", "/=high"} {
+			if _, err := sitemap.ParsePriorityRule(rule); err == nil {
+				t.Errorf("expected error for %q, got nil", rule)
+			}
+		}
+	})
+}